@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Environment variables configuring the admission webhook for Issuers and
+// ClusterIssuers using this webhook's solvers.
+const (
+	// AdmissionPortEnv names the port the admission webhook is served on. It
+	// is only served when this is set.
+	AdmissionPortEnv = "ADMISSION_PORT"
+	// AdmissionCertDirEnv names the directory holding the tls.crt and tls.key
+	// the admission webhook is served with.
+	AdmissionCertDirEnv = "ADMISSION_CERT_DIR"
+	// AdmissionCheckSecretsEnv, when "true", also rejects issuers whose
+	// referenced Secrets or keys do not exist.
+	AdmissionCheckSecretsEnv = "ADMISSION_CHECK_SECRETS"
+)
+
+// admissionPath is the path the admission webhook is served on.
+const admissionPath = "/validate-issuers"
+
+// admissionValidator validates the solver config of Issuers and ClusterIssuers
+// when they are created or updated, so config errors show up when the issuer
+// is applied instead of when a certificate is first requested.
+type admissionValidator struct {
+	solver       *customDNSProviderSolver
+	checkSecrets bool
+}
+
+// serveAdmission serves the admission webhook, when ADMISSION_PORT is set,
+// until stopCh is closed.
+func (c *customDNSProviderSolver) serveAdmission(stopCh <-chan struct{}) {
+	port := os.Getenv(AdmissionPortEnv)
+	if port == "" {
+		return
+	}
+	dir := os.Getenv(AdmissionCertDirEnv)
+	// The serving certificate is renewed in place, so reload it when it changes.
+	cert := &reloadingFile[tls.Certificate]{path: filepath.Join(dir, "tls.crt"), what: "admission webhook certificate", read: func(path string) (*tls.Certificate, error) {
+		pair, err := tls.LoadX509KeyPair(path, filepath.Join(dir, "tls.key"))
+		if err != nil {
+			return nil, err
+		}
+		return &pair, nil
+	}}
+
+	mux := http.NewServeMux()
+	mux.Handle(admissionPath, &admissionValidator{solver: c, checkSecrets: os.Getenv(AdmissionCheckSecretsEnv) == "true"})
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert.get() },
+		},
+	}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	klog.InfoS("CMI: Serving admission webhook", "port", port, "path", admissionPath)
+	if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.InfoS("CMI: Admission webhook stopped", "error", err.Error())
+	}
+}
+
+// ServeHTTP answers an AdmissionReview.
+func (a *admissionValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 3<<20)).Decode(review); err != nil || review.Request == nil {
+		http.Error(w, "CMI: Invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	review.Response = a.review(review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		klog.InfoS("CMI: Error writing AdmissionReview", "error", err.Error())
+	}
+}
+
+// review allows or denies one admission request.
+func (a *admissionValidator) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	warnings, err := a.validate(req)
+	resp.Warnings = warnings
+	if err != nil {
+		klog.InfoS("CMI: Rejected issuer", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "error", err.Error())
+		resp.Allowed = false
+		resp.Result = &metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonInvalid, Code: http.StatusUnprocessableEntity, Message: err.Error()}
+	}
+	return resp
+}
+
+// validate checks the config of every solver of the issuer that uses this
+// webhook and returns warnings about what could not be checked.
+func (a *admissionValidator) validate(req *admissionv1.AdmissionRequest) ([]string, error) {
+	var issuer struct {
+		Spec cmapi.IssuerSpec `json:"spec"`
+	}
+	if err := json.Unmarshal(req.Object.Raw, &issuer); err != nil {
+		return nil, fmt.Errorf("CMI: Error decoding %s: %w", req.Kind.Kind, err)
+	}
+	if issuer.Spec.ACME == nil {
+		return nil, nil
+	}
+	// ClusterIssuer challenges come from the cluster resource namespace.
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = clusterResourceNamespace
+	}
+
+	var warnings []string
+	for i := range issuer.Spec.ACME.Solvers {
+		dns01 := issuer.Spec.ACME.Solvers[i].DNS01
+		if dns01 == nil || dns01.Webhook == nil || dns01.Webhook.GroupName != GroupName {
+			continue
+		}
+		solverWarnings, err := a.validateSolver(dns01.Webhook, namespace, req.Namespace == "")
+		if err != nil {
+			return warnings, fmt.Errorf("spec.acme.solvers[%d].dns01.webhook.config: %w", i, err)
+		}
+		warnings = append(warnings, solverWarnings...)
+	}
+	return warnings, nil
+}
+
+// validateSolver decodes a solver config the way challenges do and checks the
+// Secrets it references may be read, and exist when checkSecrets is set.
+func (a *admissionValidator) validateSolver(webhook *cmacme.ACMEIssuerDNS01ProviderWebhook, namespace string, clusterIssuer bool) ([]string, error) {
+	var connections *connectionClient
+	bloxone := webhook.SolverName == (&bloxoneSolver{}).Name()
+	switch {
+	case bloxone:
+	case webhook.SolverName == a.solver.Name():
+		connections = a.solver.connections
+	default:
+		return nil, fmt.Errorf("CMI: Unknown solver %q", webhook.SolverName)
+	}
+
+	if webhook.Config != nil {
+		if err := decodeStrict(webhook.Config.Raw, &customDNSProviderConfig{}); err != nil {
+			return nil, fmt.Errorf("CMI: Error decoding solver config: %w", err)
+		}
+	}
+	var cfg customDNSProviderConfig
+	var err error
+	if bloxone {
+		cfg, err = loadBloxoneConfig(webhook.Config)
+	} else {
+		cfg, err = loadConfig(webhook.Config, connections)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCredentials(&cfg, bloxone, clusterIssuer); err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, ref := range secretRefs(&cfg, bloxone) {
+		warning, err := a.checkSecretRef(ref, namespace)
+		if err != nil {
+			return warnings, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings, nil
+}
+
+// checkCredentials checks that cfg says where the solver's credentials come
+// from. Only ClusterIssuers may leave that to the ambient credentials.
+func checkCredentials(cfg *customDNSProviderConfig, bloxone, clusterIssuer bool) error {
+	if bloxone {
+		if cfg.APIKeySecretRef.Name == "" || cfg.APIKeySecretRef.Key == "" {
+			return fmt.Errorf("CMI: apiKeySecretRef is required for the bloxone-ddi solver")
+		}
+		return nil
+	}
+	if cfg.Host == "" {
+		return fmt.Errorf("CMI: host is required")
+	}
+	hasSecretRefs := cfg.UsernameSecretRef.Key != "" && cfg.PasswordSecretRef.Key != ""
+	hasAmbient := clusterIssuer && (ambientCredentialsSecret != "" || ambientCredentialsFile.path != "")
+	if !hasSecretRefs && !cfg.GetUserFromVolume && !hasAmbient {
+		return fmt.Errorf("CMI: usernameSecretRef and passwordSecretRef, or getUserFromVolume, are required")
+	}
+	return nil
+}
+
+// secretRefs returns the Secret references the solver reads for cfg.
+func secretRefs(cfg *customDNSProviderConfig, bloxone bool) []secretKeySelector {
+	if bloxone {
+		return []secretKeySelector{cfg.APIKeySecretRef}
+	}
+	var refs []secretKeySelector
+	if cfg.UsernameSecretRef.Key != "" && cfg.PasswordSecretRef.Key != "" {
+		refs = append(refs, cfg.UsernameSecretRef, cfg.PasswordSecretRef)
+	}
+	if cfg.Mirror != nil && cfg.Mirror.UsernameSecretRef.Key != "" && cfg.Mirror.PasswordSecretRef.Key != "" {
+		refs = append(refs, cfg.Mirror.UsernameSecretRef, cfg.Mirror.PasswordSecretRef)
+	}
+	if cfg.RFC2136 != nil {
+		refs = append(refs, cfg.RFC2136.TSIGSecretSecretRef)
+	}
+	return refs
+}
+
+// checkSecretRef checks that ref may be read for challenges from namespace
+// and, with checkSecrets, that its Secret and key exist. Secrets the webhook
+// cannot read are reported as a warning rather than rejected.
+func (a *admissionValidator) checkSecretRef(ref secretKeySelector, namespace string) (string, error) {
+	secretNamespace, err := secretRefNamespace(ref, namespace)
+	if err != nil || !a.checkSecrets {
+		return "", err
+	}
+	if secretNamespace == "" {
+		return fmt.Sprintf("Secret %s was not checked: %s is not set", ref.Name, ClusterResourceNamespaceEnv), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	secret, err := a.solver.client.CoreV1().Secrets(secretNamespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "", fmt.Errorf("CMI: Secret %s/%s does not exist", secretNamespace, ref.Name)
+	case err != nil:
+		return fmt.Sprintf("Secret %s/%s could not be checked: %v", secretNamespace, ref.Name, err), nil
+	}
+	if _, ok := secret.Data[ref.Key]; !ok {
+		return "", fmt.Errorf("CMI: Secret %s/%s has no key %s", secretNamespace, ref.Name, ref.Key)
+	}
+	return "", nil
+}
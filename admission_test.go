@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// issuerRequest builds an admission request for an issuer with one webhook
+// solver. An empty namespace makes it a ClusterIssuer.
+func issuerRequest(t *testing.T, namespace, groupName, solverName, config string) *admissionv1.AdmissionRequest {
+	t.Helper()
+	webhook := map[string]interface{}{"groupName": groupName, "solverName": solverName}
+	if config != "" {
+		webhook["config"] = json.RawMessage(config)
+	}
+	issuer := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"acme": map[string]interface{}{
+				"server":              "https://acme.example.com/directory",
+				"privateKeySecretRef": map[string]string{"name": "account-key"},
+				"solvers":             []interface{}{map[string]interface{}{"dns01": map[string]interface{}{"webhook": webhook}}},
+			},
+		},
+	}
+	raw, err := json.Marshal(issuer)
+	require.NoError(t, err)
+
+	kind := "Issuer"
+	if namespace == "" {
+		kind = "ClusterIssuer"
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID("uid-1"),
+		Kind:      metav1.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: kind},
+		Namespace: namespace,
+		Name:      "letsencrypt",
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+// TestAdmission_Validate verifies issuers using this webhook are rejected
+// when their solver config would fail at challenge time
+func TestAdmission_Validate(t *testing.T) {
+	previousGroup := GroupName
+	GroupName = "acme.example.com"
+	t.Cleanup(func() { GroupName = previousGroup })
+	useSecretNamespaces(t, "cert-manager", "dns-credentials")
+	useAmbientCredentials(t, "", "")
+	validator := &admissionValidator{solver: newFakeWAPISolver(), checkSecrets: true}
+
+	const creds = `"usernameSecretRef": {"name": "infoblox-creds", "key": "username"}, "passwordSecretRef": {"name": "infoblox-creds", "key": "password"}`
+	tests := []struct {
+		name       string
+		namespace  string
+		groupName  string
+		solverName string
+		config     string
+		wantErr    string
+	}{
+		{name: "valid", namespace: "test-namespace", config: `{"host": "gm.example.com", ` + creds + `}`},
+		{name: "other webhook", namespace: "test-namespace", groupName: "acme.other.com", solverName: "other", config: `{"anything": true}`},
+		{name: "unknown field", namespace: "test-namespace", config: `{"host": "gm.example.com", "hostname": "gm", ` + creds + `}`, wantErr: `unknown field "hostname"`},
+		{name: "missing host", namespace: "test-namespace", config: `{` + creds + `}`, wantErr: "host is required"},
+		{name: "no credentials", namespace: "test-namespace", config: `{"host": "gm.example.com"}`, wantErr: "usernameSecretRef and passwordSecretRef"},
+		{name: "invalid option", namespace: "test-namespace", config: `{"host": "gm.example.com", "verifyRecords": "sometimes", ` + creds + `}`, wantErr: "verifyRecords"},
+		{name: "unknown solver", namespace: "test-namespace", solverName: "infoblox", config: `{}`, wantErr: `Unknown solver "infoblox"`},
+		{name: "bloxone without api key", namespace: "test-namespace", solverName: "bloxone-ddi", config: `{}`, wantErr: "apiKeySecretRef is required"},
+		{name: "bloxone with connectionRef", namespace: "test-namespace", solverName: "bloxone-ddi", config: `{"connectionRef": "prod-grid"}`, wantErr: "connectionRef is not supported"},
+		{
+			name:      "missing secret",
+			namespace: "test-namespace",
+			config:    `{"host": "gm.example.com", "usernameSecretRef": {"name": "missing", "key": "username"}, "passwordSecretRef": {"name": "missing", "key": "password"}}`,
+			wantErr:   "Secret test-namespace/missing does not exist",
+		},
+		{
+			name:      "missing key",
+			namespace: "test-namespace",
+			config:    `{"host": "gm.example.com", "usernameSecretRef": {"name": "infoblox-creds", "key": "user"}, "passwordSecretRef": {"name": "infoblox-creds", "key": "password"}}`,
+			wantErr:   "Secret test-namespace/infoblox-creds has no key user",
+		},
+		{
+			name:      "cross-namespace from Issuer",
+			namespace: "test-namespace",
+			config:    `{"host": "gm.example.com", "usernameSecretRef": {"name": "creds", "key": "username", "namespace": "dns-credentials"}, "passwordSecretRef": {"name": "creds", "key": "password", "namespace": "dns-credentials"}}`,
+			wantErr:   "only be referenced across namespaces by ClusterIssuers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupName, solverName := tt.groupName, tt.solverName
+			if groupName == "" {
+				groupName = GroupName
+			}
+			if solverName == "" {
+				solverName = "infoblox-wapi"
+			}
+
+			resp := validator.review(issuerRequest(t, tt.namespace, groupName, solverName, tt.config))
+			assert.Equal(t, types.UID("uid-1"), resp.UID)
+			if tt.wantErr != "" {
+				require.False(t, resp.Allowed)
+				assert.Contains(t, resp.Result.Message, "spec.acme.solvers[0].dns01.webhook.config")
+				assert.Contains(t, resp.Result.Message, tt.wantErr)
+				return
+			}
+			assert.True(t, resp.Allowed, resp.Result)
+		})
+	}
+}
+
+// TestAdmission_AmbientCredentials verifies only ClusterIssuers may leave
+// their credentials to the ambient credentials
+func TestAdmission_AmbientCredentials(t *testing.T) {
+	previousGroup := GroupName
+	GroupName = "acme.example.com"
+	t.Cleanup(func() { GroupName = previousGroup })
+	useSecretNamespaces(t, "cert-manager")
+	useAmbientCredentials(t, "platform-creds", "")
+	validator := &admissionValidator{solver: newFakeWAPISolver()}
+
+	resp := validator.review(issuerRequest(t, "", GroupName, "infoblox-wapi", `{"host": "gm.example.com"}`))
+	assert.True(t, resp.Allowed, resp.Result)
+
+	resp = validator.review(issuerRequest(t, "test-namespace", GroupName, "infoblox-wapi", `{"host": "gm.example.com"}`))
+	require.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Message, "usernameSecretRef and passwordSecretRef")
+}
+
+// TestAdmission_BloxOneIgnoresDefaults verifies bloxone-ddi issuers are
+// validated without the WAPI webhook defaults and their override policy
+func TestAdmission_BloxOneIgnoresDefaults(t *testing.T) {
+	previousGroup := GroupName
+	GroupName = "acme.example.com"
+	t.Cleanup(func() { GroupName = previousGroup })
+	useDefaults(t, "config:\n  host: gm.example.com\n  view: corp\nallowOverride: [ttl]\n")
+	validator := &admissionValidator{solver: newFakeWAPISolver()}
+
+	const config = `{"host": "https://csp.eu.infoblox.com", "apiKeySecretRef": {"name": "bloxone-creds", "key": "api-key"}}`
+	resp := validator.review(issuerRequest(t, "test-namespace", GroupName, "bloxone-ddi", config))
+	assert.True(t, resp.Allowed, resp.Result)
+
+	resp = validator.review(issuerRequest(t, "test-namespace", GroupName, "infoblox-wapi", `{"host": "gm.other.example.com"}`))
+	require.False(t, resp.Allowed)
+	assert.Contains(t, resp.Result.Message, "may not override [host]")
+}
+
+// postReview posts body to url and closes the response when the test ends.
+func postReview(t *testing.T, url string, body []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// TestAdmission_ServeHTTP verifies the handler answers an AdmissionReview
+// with a response for the same request
+func TestAdmission_ServeHTTP(t *testing.T) {
+	previousGroup := GroupName
+	GroupName = "acme.example.com"
+	t.Cleanup(func() { GroupName = previousGroup })
+	server := httptest.NewServer(&admissionValidator{solver: newFakeWAPISolver()})
+	t.Cleanup(server.Close)
+
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  issuerRequest(t, "", GroupName, "infoblox-wapi", `{"view": "default"}`),
+	}
+	body, err := json.Marshal(review)
+	require.NoError(t, err)
+
+	resp := postReview(t, server.URL+admissionPath, body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got admissionv1.AdmissionReview
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, "AdmissionReview", got.Kind)
+	require.NotNil(t, got.Response)
+	assert.Equal(t, types.UID("uid-1"), got.Response.UID)
+	assert.False(t, got.Response.Allowed)
+	assert.Contains(t, got.Response.Result.Message, "host is required")
+
+	resp = postReview(t, server.URL+admissionPath, []byte("{}"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Environment variables naming the webhook's ambient credentials: a file in
+// the same form as the mounted secret file, or a Secret with username and
+// password keys in the webhook's namespace.
+const (
+	AmbientCredentialsFileEnv   = "AMBIENT_CREDENTIALS_FILE"
+	AmbientCredentialsSecretEnv = "AMBIENT_CREDENTIALS_SECRET"
+)
+
+// ambientCredentialsFile is the file named by AMBIENT_CREDENTIALS_FILE, if any,
+// reloaded when the credential is rotated.
+var ambientCredentialsFile = &reloadingFile[usernamePassword]{path: os.Getenv(AmbientCredentialsFileEnv), what: "ambient credentials file", read: readAmbientCredentials}
+
+// ambientCredentialsSecret is the Secret named by AMBIENT_CREDENTIALS_SECRET,
+// if any.
+var ambientCredentialsSecret = os.Getenv(AmbientCredentialsSecretEnv)
+
+// readAmbientCredentials reads an ambient credentials file in YAML or JSON.
+func readAmbientCredentials(path string) (*usernamePassword, error) {
+	creds := &usernamePassword{}
+	if err := decodeFile(path, "ambient credentials file", creds); err != nil {
+		return nil, err
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return nil, fmt.Errorf("CMI: Ambient credentials file %s needs a username and password", path)
+	}
+	klog.InfoS("CMI: Loaded ambient credentials file", "path", path, "username", creds.Username)
+	return creds, nil
+}
+
+// ambientCredentials returns the webhook's own Infoblox credential for a
+// challenge from namespace whose config names none. It is only used for
+// ClusterIssuers: the challenge must come from the cluster resource namespace
+// and cert-manager must allow ambient credentials for it. cert-manager may be
+// told to allow them for namespaced Issuers too, e.g. for workload identity,
+// so that alone does not keep them from borrowing the platform account.
+func (c *customDNSProviderSolver) ambientCredentials(namespace string, allowAmbient bool) (string, string, error) {
+	if ambientCredentialsSecret == "" && ambientCredentialsFile.path == "" {
+		return "", "", fmt.Errorf("CMI: No secretRefs or secretPath provided")
+	}
+	if !allowAmbient || clusterResourceNamespace == "" || namespace != clusterResourceNamespace {
+		return "", "", fmt.Errorf("CMI: No secretRefs or secretPath provided, and ambient credentials are only used for ClusterIssuers")
+	}
+
+	if ambientCredentialsSecret != "" {
+		secretNamespace := os.Getenv("POD_NAMESPACE")
+		klog.InfoS("CMI: Getting Infoblox User and Password from ambient credentials Secret", "name", ambientCredentialsSecret, "namespace", secretNamespace)
+		ref := cmmeta.LocalObjectReference{Name: ambientCredentialsSecret}
+		username, err := c.getSecret(cmmeta.SecretKeySelector{LocalObjectReference: ref, Key: "username"}, secretNamespace)
+		if err != nil {
+			return "", "", err
+		}
+		password, err := c.getSecret(cmmeta.SecretKeySelector{LocalObjectReference: ref, Key: "password"}, secretNamespace)
+		if err != nil {
+			return "", "", err
+		}
+		klog.InfoS("CMI: Infoblox User", "username", username)
+		return username, password, nil
+	}
+
+	klog.InfoS("CMI: Getting Infoblox User and Password from ambient credentials file", "path", ambientCredentialsFile.path)
+	creds, err := ambientCredentialsFile.get()
+	if err != nil {
+		return "", "", err
+	}
+	klog.InfoS("CMI: Infoblox User", "username", creds.Username)
+	return creds.Username, creds.Password, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useAmbientCredentials configures the ambient credentials Secret name and
+// file path for the duration of the test.
+func useAmbientCredentials(t *testing.T, secret, path string) {
+	t.Helper()
+	previousSecret, previousFile := ambientCredentialsSecret, ambientCredentialsFile
+	ambientCredentialsSecret = secret
+	ambientCredentialsFile = &reloadingFile[usernamePassword]{path: path, what: "ambient credentials file", read: readAmbientCredentials}
+	t.Cleanup(func() { ambientCredentialsSecret, ambientCredentialsFile = previousSecret, previousFile })
+}
+
+// TestGetCredentials_Ambient verifies the ambient credentials are used only
+// when the config names none and the challenge comes from a ClusterIssuer
+// that allows ambient credentials
+func TestGetCredentials_Ambient(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "cert-manager")
+	useSecretNamespaces(t, "cert-manager")
+	solver := newFakeWAPISolver()
+	_, err := solver.client.CoreV1().Secrets("cert-manager").Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform-creds", Namespace: "cert-manager"},
+		Data:       map[string][]byte{"username": []byte("platform"), "password": []byte("platform-pass")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "creds.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("username: file-user\npassword: file-pass\n"), 0o600))
+	badPath := filepath.Join(t.TempDir(), "creds.yaml")
+	require.NoError(t, os.WriteFile(badPath, []byte("username: file-user\n"), 0o600))
+
+	secretRefs := customDNSProviderConfig{}
+	secretRefs.UsernameSecretRef.Name, secretRefs.UsernameSecretRef.Key = "infoblox-creds", "username"
+	secretRefs.PasswordSecretRef.Name, secretRefs.PasswordSecretRef.Key = "infoblox-creds", "password"
+
+	tests := []struct {
+		name         string
+		secret       string
+		path         string
+		cfg          customDNSProviderConfig
+		namespace    string
+		allowAmbient bool
+		wantUser     string
+		wantErr      string
+	}{
+		{name: "ambient secret", secret: "platform-creds", allowAmbient: true, wantUser: "platform"},
+		{name: "ambient file", path: path, allowAmbient: true, wantUser: "file-user"},
+		{name: "secretRefs win", secret: "platform-creds", cfg: secretRefs, namespace: "test-namespace", allowAmbient: true, wantUser: "admin"},
+		{name: "not allowed", secret: "platform-creds", wantErr: "only used for ClusterIssuers"},
+		{name: "namespaced issuer allowed ambient", secret: "platform-creds", namespace: "test-namespace", allowAmbient: true, wantErr: "only used for ClusterIssuers"},
+		{name: "not configured", allowAmbient: true, wantErr: "No secretRefs or secretPath provided"},
+		{name: "invalid file", path: badPath, allowAmbient: true, wantErr: "needs a username and password"},
+		{name: "missing secret", secret: "other-creds", allowAmbient: true, wantErr: "failed to get secret cert-manager/other-creds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAmbientCredentials(t, tt.secret, tt.path)
+			namespace := tt.namespace
+			if namespace == "" {
+				namespace = "cert-manager"
+			}
+
+			username, password, err := solver.getCredentials(&tt.cfg, namespace, tt.allowAmbient)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantUser, username)
+			assert.NotEmpty(t, password)
+		})
+	}
+}
+
+// TestPresent_AmbientCredentials verifies a ClusterIssuer challenge without
+// secretRefs is presented with the ambient credentials
+func TestPresent_AmbientCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"username": "platform", "password": "platform-pass"}`), 0o600))
+	useAmbientCredentials(t, "", path)
+	useSecretNamespaces(t, "cert-manager")
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{
+		"view":              "default",
+		"usernameSecretRef": map[string]string{},
+		"passwordSecretRef": map[string]string{},
+	}
+
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)
+	ch.ResourceNamespace = "cert-manager"
+	require.Error(t, solver.Present(ch))
+	assert.Empty(t, f.find("record:txt", nil))
+
+	ch.AllowAmbientCredentials = true
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", nil), 1)
+
+	// A namespaced Issuer allowed ambient credentials still may not use them.
+	ch = fakeChallenge(t, f, "_acme-challenge.example.com.", "key-2", extra)
+	ch.AllowAmbientCredentials = true
+	err := solver.Present(ch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only used for ClusterIssuers")
+	assert.Len(t, f.find("record:txt", nil), 1)
+}
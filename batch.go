@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+// errBatchUnsupported is returned when a connector cannot send WAPI
+// multi-object requests at all.
+var errBatchUnsupported = errors.New("CMI: Connector does not support WAPI multi-object requests")
+
+// batchSupportCache remembers Grids that rejected the WAPI `request` object
+// so they are not asked again for the lifetime of the process.
+type batchSupportCache struct {
+	mu          sync.Mutex
+	unsupported map[string]bool
+}
+
+func (b *batchSupportCache) supported(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.unsupported[key]
+}
+
+func (b *batchSupportCache) markUnsupported(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.unsupported == nil {
+		b.unsupported = make(map[string]bool)
+	}
+	b.unsupported[key] = true
+}
+
+// multiObjectCreator is implemented by connectors able to send a WAPI
+// multi-object request and return its decoded results.
+type multiObjectCreator interface {
+	CreateMultiObject(req *ibclient.MultiRequest) ([]map[string]interface{}, error)
+}
+
+// createMultiObject sends req to the `request` object in a single round trip.
+func createMultiObject(ib ibclient.IBConnector, req *ibclient.MultiRequest) ([]map[string]interface{}, error) {
+	switch conn := ib.(type) {
+	case multiObjectCreator:
+		return conn.CreateMultiObject(req)
+	case *ibclient.Connector:
+		// CreateMultiObject is not part of IBObjectManager and only works on a
+		// concrete *Connector.
+		objMgr, ok := ibclient.NewObjectManager(conn, "", "").(*ibclient.ObjectManager)
+		if !ok {
+			return nil, errBatchUnsupported
+		}
+		return objMgr.CreateMultiObject(req)
+	default:
+		return nil, errBatchUnsupported
+	}
+}
+
+// isBatchUnsupportedError reports whether err means the Grid does not know
+// the `request` object at all. Other failures, including objects a batched
+// request did not find, say nothing about the Grid and are not remembered.
+func isBatchUnsupportedError(err error) bool {
+	return errors.Is(err, errBatchUnsupported) ||
+		strings.Contains(err.Error(), "Unknown object type (request)")
+}
+
+// isConflictError reports whether WAPI refused a create with a data conflict.
+// Besides an identical record already existing, this also covers e.g. a
+// missing parent zone or a CNAME at the name, so callers have to look.
+func isConflictError(err error) bool {
+	return strings.Contains(err.Error(), "IB.Data.Conflict") || strings.Contains(err.Error(), "already exists")
+}
+
+// presentBatched creates the TXT record with a single multi-object request
+// instead of a lookup followed by a create. WAPI rejects an identical record
+// with a data conflict, which is treated as the record already being present
+// once a lookup finds it.
+// handled is false when the caller should fall back to the two-step path,
+// which is always the case unless batchRequests is set, and for shared and
+// cloud records, which are created differently.
+func (c *customDNSProviderSolver) presentBatched(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string) (ref string, handled bool) {
+	key := gridKey(cfg)
+	if !cfg.BatchRequests || cfg.SharedRecordGroup != "" || cfg.Cloud != nil || !c.batchSupport.supported(key) {
+		return "", false
+	}
+
+	data := map[string]interface{}{
+		"name":    name,
+		"text":    text,
+		"view":    cfg.View,
+		"ttl":     cfg.TTL,
+		"use_ttl": cfg.UseTTL,
+	}
+	if cfg.comment != "" {
+		data["comment"] = cfg.comment
+	}
+	if cfg.DynamicRecords {
+		data["creator"] = creatorDynamic
+		data["ddns_principal"] = cfg.DDNSPrincipal
+	}
+	req := ibclient.NewMultiRequest([]*ibclient.RequestBody{
+		{
+			Method: "POST",
+			Object: "record:txt",
+			Data:   data,
+			Args:   map[string]string{"_return_fields": "name,text,view"},
+		},
+	})
+
+	klog.InfoS("CMI: Creating TXT record with a batched request", "name", name)
+	results, err := createMultiObject(ib, req)
+	if err != nil {
+		if isConflictError(err) {
+			return "", c.presentConflict(ib, cfg, name, text, err)
+		}
+		return "", c.handleBatchError(key, "present", name, err)
+	}
+
+	ref, err = batchResultRef(results, "_ref")
+	if err != nil {
+		klog.InfoS("CMI: Unexpected batched create response, falling back", "name", name, "error", err.Error())
+		return "", false
+	}
+	return ref, true
+}
+
+// cleanUpBatched looks up and deletes the TXT record with a single
+// multi-object request, carrying the ref from the search to the delete with
+// assign_state. Only the first match is deleted; the caller looks for and
+// deletes any duplicates left by earlier runs afterwards.
+// handled is false when the caller should fall back to the two-step path,
+// which also covers the record not existing, batchRequests not being set and
+// shared records.
+func (c *customDNSProviderSolver) cleanUpBatched(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string) (ref string, handled bool) {
+	key := gridKey(cfg)
+	if !cfg.BatchRequests || cfg.SharedRecordGroup != "" || !c.batchSupport.supported(key) {
+		return "", false
+	}
+
+	klog.InfoS("CMI: Deleting TXT record with a batched request", "name", name)
+	results, err := createMultiObject(ib, searchAndDeleteRequest("record:txt", txtSearchFields(name, text, cfg.View)))
+	if err != nil {
+		// A missing record makes the substitution fail; the two-step path
+		// tells that apart from real errors.
+		c.handleBatchError(key, "cleanup", name, err)
+		return "", false
+	}
+
+	ref, err = batchResultRef(results, "ref")
+	if err != nil {
+		klog.InfoS("CMI: Unexpected batched delete response, falling back", "name", name, "error", err.Error())
+		return "", false
+	}
+	return ref, true
+}
+
+// searchAndDeleteRequest builds a multi-object request that deletes the first
+// object of type object matching fields and displays its ref. The search and
+// the delete run in one WAPI transaction, so nothing else can change the
+// record in between, and the request fails as a whole if nothing matches.
+func searchAndDeleteRequest(object string, fields map[string]string) *ibclient.MultiRequest {
+	data := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		data[k] = v
+	}
+	return ibclient.NewMultiRequest([]*ibclient.RequestBody{
+		{
+			Method:      "GET",
+			Object:      object,
+			Data:        data,
+			AssignState: map[string]string{"ref": "_ref"},
+			Discard:     true,
+		},
+		{
+			Method:             "DELETE",
+			Object:             "##STATE:ref:##",
+			EnableSubstitution: true,
+			Discard:            true,
+		},
+		{
+			Method: "STATE:DISPLAY",
+		},
+	})
+}
+
+// txtSearchFields returns the fields selecting the record:txt objects of a
+// challenge.
+func txtSearchFields(name, text, view string) map[string]string {
+	return map[string]string{
+		"name": name,
+		"text": text,
+		"view": view,
+	}
+}
+
+// presentConflict reports whether the data conflict err a batched create
+// failed with is the identical record already existing. Otherwise the caller
+// falls back to the two-step path, whose create reports the actual conflict.
+func (c *customDNSProviderSolver) presentConflict(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string, err error) bool {
+	refs, lookupErr := c.GetTXTRecords(ib, cfg, name, text)
+	if lookupErr != nil || len(refs) == 0 {
+		klog.InfoS("CMI: Batched create conflicted with something other than the record, falling back", "name", name, "error", err.Error())
+		return false
+	}
+	klog.InfoS("CMI: TXT record already exists with the correct value, nothing to do", "name", name, "ref", refs[0])
+	return true
+}
+
+// handleBatchError logs a failed batched request, remembers Grids that do not
+// support it, and reports whether the failure settles the operation.
+func (c *customDNSProviderSolver) handleBatchError(key, op, name string, err error) bool {
+	switch {
+	case isBatchUnsupportedError(err):
+		klog.InfoS("CMI: Grid does not support batched requests, falling back for this Grid", "grid", key, "error", err.Error())
+		c.batchSupport.markUnsupported(key)
+		return false
+	default:
+		klog.InfoS("CMI: Batched request failed, falling back", "operation", op, "name", name, "error", err.Error())
+		return false
+	}
+}
+
+// batchResultRef extracts a ref from the first result of a multi-object request.
+func batchResultRef(results []map[string]interface{}, field string) (string, error) {
+	if len(results) == 0 {
+		return "", fmt.Errorf("empty result")
+	}
+	ref, ok := results[0][field].(string)
+	if !ok || ref == "" {
+		return "", fmt.Errorf("result has no %q field: %v", field, results[0])
+	}
+	return ref, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchExtra is the solver config used by the batched request tests.
+var batchExtra = map[string]interface{}{"view": "default", "version": "2.10", "batchRequests": true}
+
+// TestBatch_PresentAndCleanUp verifies each operation takes a single
+// multi-object request
+func TestBatch_PresentAndCleanUp(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.rejectDuplicates = true
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra)
+
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", map[string]string{"name": "_acme-challenge.example.com", "text": "key-1"}), 1)
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("record:txt", nil))
+
+	assert.Equal(t, 2, f.count("POST request"))
+	assert.Zero(t, f.count("POST record:txt"))
+	assert.Zero(t, f.count("DELETE record:txt"))
+}
+
+// TestBatch_PresentExisting verifies a conflict on create is confirmed to be
+// the record already being there
+func TestBatch_PresentExisting(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.rejectDuplicates = true
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra)
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(ch))
+
+	assert.Len(t, f.find("record:txt", nil), 1)
+	assert.Equal(t, 1, f.count("GET record:txt"), "the conflict should be confirmed with a lookup")
+	assert.Zero(t, f.count("POST record:txt"))
+}
+
+// TestBatch_PresentOtherConflict verifies a data conflict that is not the
+// record already existing fails Present
+func TestBatch_PresentOtherConflict(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.conflictNames = map[string]bool{"_acme-challenge.example.com": true}
+	solver := newFakeWAPISolver()
+
+	err := solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "A parent was not found")
+	assert.Empty(t, f.find("record:txt", nil))
+}
+
+// TestBatch_CleanUpRemovesDuplicates verifies a batched CleanUp also deletes
+// duplicates left by earlier runs while records with another value are kept
+func TestBatch_CleanUpRemovesDuplicates(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	record := map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-1", "view": "default"}
+	for i := 0; i < 3; i++ {
+		f.add("record:txt", record)
+	}
+	f.add("record:txt", map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-2", "view": "default"})
+
+	require.NoError(t, solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra)))
+
+	assert.Empty(t, f.find("record:txt", map[string]string{"text": "key-1"}))
+	assert.Len(t, f.find("record:txt", map[string]string{"text": "key-2"}), 1)
+}
+
+// TestBatch_CleanUpMissing verifies a missing record falls back to the
+// two-step path, which treats it as already cleaned up
+func TestBatch_CleanUpMissing(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+
+	require.NoError(t, solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra)))
+
+	assert.Positive(t, f.count("GET record:txt"))
+	host, port := f.hostPort()
+	assert.True(t, solver.batchSupport.supported(gridKey(&customDNSProviderConfig{Host: host, Port: port})))
+}
+
+// TestBatch_FallbackOnOldGrid verifies Grids without the request object are
+// remembered and served with the two-step path
+func TestBatch_FallbackOnOldGrid(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.noBatch = true
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", batchExtra)
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.CleanUp(ch))
+	requestsAfterFirst := f.count("POST request")
+
+	require.NoError(t, solver.Present(ch))
+
+	assert.Len(t, f.find("record:txt", nil), 1)
+	assert.Equal(t, requestsAfterFirst, f.count("POST request"), "unsupported Grid should not be asked again")
+	assert.Positive(t, f.count("POST record:txt"))
+}
+
+// TestIsBatchUnsupportedError verifies only an unknown `request` object marks
+// a Grid as not supporting batched requests
+func TestIsBatchUnsupportedError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connector", err: errBatchUnsupported, want: true},
+		{name: "unknown request object", err: errors.New("AdmConProtoError: Unknown object type (request)"), want: true},
+		{name: "not found", err: ibclient.NewNotFoundError("record:txt not found")},
+		{name: "other unknown object type", err: errors.New("AdmConProtoError: Unknown object type (record:foo)")},
+		{name: "server error", err: errors.New("500 Internal Server Error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isBatchUnsupportedError(tt.err))
+
+			solver := newFakeWAPISolver()
+			solver.handleBatchError("gm.example.com:443", "cleanup", "_acme-challenge.example.com", tt.err)
+			assert.Equal(t, !tt.want, solver.batchSupport.supported("gm.example.com:443"))
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// defaultBloxOneHost is the Infoblox Cloud Services Portal serving the
+// BloxOne DDI API.
+const defaultBloxOneHost = "https://csp.infoblox.com"
+
+// bloxOneAPIPath is the prefix of the BloxOne DDI API.
+const bloxOneAPIPath = "/api/ddi/v1/"
+
+// errBloxOneNotFound is returned for API responses with status 404.
+var errBloxOneNotFound = errors.New("not found")
+
+// Validate the bloxoneSolver satisfies the interface that cert manager expects.
+var _ webhook.Solver = (*bloxoneSolver)(nil)
+
+// bloxoneSolver presents challenges in BloxOne DDI (Universal DDI), the
+// Infoblox SaaS, through its API-key authenticated REST API. It shares the
+// solver config, Secret handling and per-record locking of the WAPI solver.
+type bloxoneSolver struct {
+	// common is the registered WAPI solver, which provides the Kubernetes
+	// client and the challenge locks.
+	common *customDNSProviderSolver
+}
+
+// Name is used as the name for this DNS solver when referencing it on the ACME
+// Issuer resource.
+func (b *bloxoneSolver) Name() string {
+	return "bloxone-ddi"
+}
+
+// Initialize does nothing: the Kubernetes client and locks shared with the
+// WAPI solver are set up once, by its Initialize.
+func (b *bloxoneSolver) Initialize(_ *rest.Config, _ <-chan struct{}) error {
+	return nil
+}
+
+// Present creates the TXT record in the challenge's BloxOne auth zone unless
+// an identical one already exists.
+func (b *bloxoneSolver) Present(ch *whapi.ChallengeRequest) error {
+	klog.InfoS("CMI: Presenting DNS record in BloxOne", "DNS", ch.DNSName)
+	api, zone, name, err := b.prepare(ch, opPresent)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := b.common.lockChallenge(name, zone.View)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ids, err := api.findTXTRecords(zone, name, ch.Key)
+	if err != nil {
+		return fmt.Errorf("CMI: Error getting BloxOne TXT records for %s: %w", name, err)
+	}
+	if len(ids) > 0 {
+		klog.InfoS("CMI: TXT record already exists with the correct value, nothing to do", "name", name, "id", ids[0])
+		return nil
+	}
+
+	id, err := api.createTXTRecord(zone, name, ch.Key, api.cfg.comment)
+	if err != nil {
+		return fmt.Errorf("CMI: Error creating BloxOne TXT record %s: %w", name, err)
+	}
+	klog.InfoS("CMI: Successfully created TXT record", "name", name, "id", id)
+	return nil
+}
+
+// CleanUp deletes every TXT record in the challenge's BloxOne auth zone with
+// the challenge's name and value, leaving other values at the same name alone.
+func (b *bloxoneSolver) CleanUp(ch *whapi.ChallengeRequest) error {
+	klog.InfoS("CMI: Cleaning up DNS record in BloxOne", "DNS", ch.DNSName)
+	api, zone, name, err := b.prepare(ch, opCleanUp)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := b.common.lockChallenge(name, zone.View)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ids, err := api.findTXTRecords(zone, name, ch.Key)
+	if err != nil {
+		return fmt.Errorf("CMI: Error getting BloxOne TXT records for %s: %w", name, err)
+	}
+	if len(ids) == 0 {
+		klog.InfoS("CMI: TXT record not found, skipping deletion", "name", name, "text", ch.Key)
+		return nil
+	}
+
+	var errs []error
+	for _, id := range ids {
+		klog.InfoS("CMI: Deleting TXT record", "name", name, "id", id)
+		if err := api.delete(id); err != nil && !errors.Is(err, errBloxOneNotFound) {
+			errs = append(errs, fmt.Errorf("CMI: Error deleting BloxOne TXT record %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// prepare loads the config, enforces the zone policy for op, builds an API
+// client and resolves the auth zone and the normalized record name of the
+// challenge.
+func (b *bloxoneSolver) prepare(ch *whapi.ChallengeRequest, op string) (*bloxoneClient, bloxoneZone, string, error) {
+	cfg, err := loadBloxoneConfig(ch.Config)
+	if err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	if err := b.common.authorizeChallenge(&cfg, ch, op); err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	if cfg.APIKeySecretRef.Name == "" || cfg.APIKeySecretRef.Key == "" {
+		return nil, bloxoneZone{}, "", fmt.Errorf("CMI: apiKeySecretRef is required for the bloxone-ddi solver")
+	}
+	apiKey, err := b.common.getSecretRef(cfg.APIKeySecretRef, ch.ResourceNamespace)
+	if err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	api := newBloxoneClient(&cfg, apiKey)
+
+	name, err := bloxoneFQDN(ch.ResolvedFQDN)
+	if err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	zoneName, err := bloxoneFQDN(ch.ResolvedZone)
+	if err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	zone, err := api.findAuthZone(zoneName)
+	if err != nil {
+		return nil, bloxoneZone{}, "", err
+	}
+	cfg.comment = renderComment(&cfg, ch, name)
+	return api, zone, name, nil
+}
+
+// loadBloxoneConfig loads a bloxone-ddi solver config. The webhook defaults
+// and their override policy describe the WAPI Grid, so they are not layered
+// under it. InfobloxConnections describe WAPI Grids too, and the record is
+// always written at the name cert-manager resolved, so connectionRef,
+// challengeRelocation and sharedRecordGroup are rejected rather than
+// silently ignored.
+func loadBloxoneConfig(cfgJSON *apiextensionsv1.JSON) (customDNSProviderConfig, error) {
+	cfg := customDNSProviderConfig{}
+	if cfgJSON == nil {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("CMI: Error decoding solver config: %w", err)
+	}
+	if cfg.ConnectionRef != "" {
+		return cfg, fmt.Errorf("CMI: connectionRef is not supported by the bloxone-ddi solver")
+	}
+	if err := finishConfig(&cfg); err != nil {
+		return cfg, err
+	}
+	if len(cfg.ChallengeRelocation) > 0 {
+		return cfg, fmt.Errorf("CMI: challengeRelocation is not supported by the bloxone-ddi solver")
+	}
+	if cfg.SharedRecordGroup != "" {
+		return cfg, fmt.Errorf("CMI: sharedRecordGroup is not supported by the bloxone-ddi solver")
+	}
+	return cfg, nil
+}
+
+// bloxoneZone is the part of a BloxOne dns/auth_zone the solver uses.
+type bloxoneZone struct {
+	ID   string `json:"id"`
+	FQDN string `json:"fqdn"`
+	View string `json:"view"`
+}
+
+// bloxoneRecord is the part of a BloxOne dns/record the solver uses.
+type bloxoneRecord struct {
+	ID         string            `json:"id,omitempty"`
+	Zone       string            `json:"zone,omitempty"`
+	NameInZone string            `json:"name_in_zone"`
+	Type       string            `json:"type,omitempty"`
+	RData      map[string]string `json:"rdata,omitempty"`
+	TTL        *uint32           `json:"ttl,omitempty"`
+	Comment    string            `json:"comment,omitempty"`
+}
+
+// bloxoneClient calls the BloxOne DDI API with an API key.
+type bloxoneClient struct {
+	cfg     *customDNSProviderConfig
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// newBloxoneClient returns a client for cfg.Host, which defaults to the
+// Cloud Services Portal and to https when it has no scheme.
+func newBloxoneClient(cfg *customDNSProviderConfig, apiKey string) *bloxoneClient {
+	host := cfg.Host
+	if host == "" {
+		host = defaultBloxOneHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return &bloxoneClient{
+		cfg:     cfg,
+		baseURL: strings.TrimSuffix(host, "/") + bloxOneAPIPath,
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: time.Duration(cfg.HTTPRequestTimeout) * time.Second},
+	}
+}
+
+// findAuthZone returns the auth zone named zone, in the configured view when
+// one is set.
+func (a *bloxoneClient) findAuthZone(zone string) (bloxoneZone, error) {
+	filter := fmt.Sprintf("fqdn==%q", zone+".")
+	if a.cfg.View != "" {
+		viewID, err := a.findViewID(a.cfg.View)
+		if err != nil {
+			return bloxoneZone{}, err
+		}
+		filter += fmt.Sprintf(" and view==%q", viewID)
+	}
+
+	var zones []bloxoneZone
+	if err := a.list("dns/auth_zone", filter, &zones); err != nil {
+		return bloxoneZone{}, fmt.Errorf("CMI: Error looking up BloxOne auth zone %s: %w", zone, err)
+	}
+	switch len(zones) {
+	case 0:
+		return bloxoneZone{}, fmt.Errorf("CMI: BloxOne auth zone %s not found", zone)
+	case 1:
+		return zones[0], nil
+	default:
+		return bloxoneZone{}, fmt.Errorf("CMI: BloxOne auth zone %s exists in %d views, set view", zone, len(zones))
+	}
+}
+
+// findViewID returns the id of the view named name.
+func (a *bloxoneClient) findViewID(name string) (string, error) {
+	var views []struct {
+		ID string `json:"id"`
+	}
+	if err := a.list("dns/view", fmt.Sprintf("name==%q", name), &views); err != nil {
+		return "", fmt.Errorf("CMI: Error looking up BloxOne view %s: %w", name, err)
+	}
+	if len(views) == 0 {
+		return "", fmt.Errorf("CMI: BloxOne view %s not found", name)
+	}
+	return views[0].ID, nil
+}
+
+// findTXTRecords returns the ids of the TXT records in zone at name whose
+// text is text.
+func (a *bloxoneClient) findTXTRecords(zone bloxoneZone, name, text string) ([]string, error) {
+	nameInZone, err := bloxoneNameInZone(name, zone.FQDN)
+	if err != nil {
+		return nil, err
+	}
+	var records []bloxoneRecord
+	filter := fmt.Sprintf("zone==%q and name_in_zone==%q and type==\"TXT\"", zone.ID, nameInZone)
+	if err := a.list("dns/record", filter, &records); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, record := range records {
+		if record.RData["text"] == text {
+			ids = append(ids, record.ID)
+		}
+	}
+	return ids, nil
+}
+
+// createTXTRecord creates a TXT record in zone and returns its id.
+func (a *bloxoneClient) createTXTRecord(zone bloxoneZone, name, text, comment string) (string, error) {
+	nameInZone, err := bloxoneNameInZone(name, zone.FQDN)
+	if err != nil {
+		return "", err
+	}
+	record := bloxoneRecord{
+		Zone:       zone.ID,
+		NameInZone: nameInZone,
+		Type:       "TXT",
+		RData:      map[string]string{"text": text},
+		Comment:    comment,
+	}
+	if a.cfg.UseTTL {
+		record.TTL = &a.cfg.TTL
+	}
+
+	var created struct {
+		Result bloxoneRecord `json:"result"`
+	}
+	if err := a.do(http.MethodPost, "dns/record", nil, record, &created); err != nil {
+		return "", err
+	}
+	return created.Result.ID, nil
+}
+
+// delete deletes the object with the given id, e.g. dns/record/<uuid>.
+func (a *bloxoneClient) delete(id string) error {
+	return a.do(http.MethodDelete, id, nil, nil, nil)
+}
+
+// list fetches the objects of type object matching filter into results.
+func (a *bloxoneClient) list(object, filter string, results interface{}) error {
+	var page struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := a.do(http.MethodGet, object, url.Values{"_filter": {filter}}, nil, &page); err != nil {
+		return err
+	}
+	if len(page.Results) == 0 {
+		return nil
+	}
+	return json.Unmarshal(page.Results, results)
+}
+
+// do sends a request to the API and decodes the response into out.
+func (a *bloxoneClient) do(method, path string, query url.Values, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+
+	target := a.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, target, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+a.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s %s: %w", method, path, errBloxOneNotFound)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(raw)))
+	case out == nil || len(raw) == 0:
+		return nil
+	default:
+		return json.Unmarshal(raw, out)
+	}
+}
+
+// bloxoneNameInZone returns name relative to zone, which BloxOne records are
+// named by. An empty name is the zone apex.
+func bloxoneNameInZone(name, zone string) (string, error) {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	name = strings.ToLower(name)
+	if name == zone {
+		return "", nil
+	}
+	relative, ok := strings.CutSuffix(name, "."+zone)
+	if !ok {
+		return "", fmt.Errorf("CMI: Record name %s is not inside BloxOne zone %s", name, zone)
+	}
+	return relative, nil
+}
+
+// bloxoneFQDN normalizes fqdn like normalizeFQDN, but in the punycode form
+// BloxOne names zones and records by.
+func bloxoneFQDN(fqdn string) (string, error) {
+	name, err := normalizeFQDN(fqdn)
+	if err != nil {
+		return "", err
+	}
+	return idnaProfile.ToASCII(name)
+}
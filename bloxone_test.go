@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeBloxOne is an in-memory stand-in for the BloxOne DDI API, supporting
+// the list, create and delete calls the solver makes with `==` filters joined
+// by `and`.
+type fakeBloxOne struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]map[string]interface{}
+	nextID   int
+	requests map[string]int
+}
+
+func newFakeBloxOne(t *testing.T) *fakeBloxOne {
+	f := &fakeBloxOne{t: t, objects: map[string]map[string]interface{}{}, requests: map[string]int{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// add stores an object of the given type, e.g. dns/auth_zone, and returns its id.
+func (f *fakeBloxOne) add(objType string, fields map[string]interface{}) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addLocked(objType, fields)
+}
+
+func (f *fakeBloxOne) addLocked(objType string, fields map[string]interface{}) string {
+	f.nextID++
+	id := fmt.Sprintf("%s/%08d-0000-0000-0000-000000000000", objType, f.nextID)
+	obj := map[string]interface{}{"id": id}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	f.objects[id] = obj
+	return id
+}
+
+// records returns the stored dns/record objects.
+func (f *fakeBloxOne) records() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []map[string]interface{}
+	for id, obj := range f.objects {
+		if strings.HasPrefix(id, "dns/record/") {
+			found = append(found, obj)
+		}
+	}
+	return found
+}
+
+func (f *fakeBloxOne) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token api-key-1" {
+		http.Error(w, `{"error":[{"message":"unauthorized"}]}`, http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, bloxOneAPIPath)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method+" "+path]++
+
+	switch r.Method {
+	case http.MethodGet:
+		results := []map[string]interface{}{}
+		for id, obj := range f.objects {
+			if strings.HasPrefix(id, path+"/") && matchesFilter(obj, r.URL.Query().Get("_filter")) {
+				results = append(results, obj)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	case http.MethodPost:
+		var fields map[string]interface{}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&fields))
+		id := f.addLocked(path, fields)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"result": f.objects[id]})
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			http.Error(w, `{"error":[{"message":"not found"}]}`, http.StatusNotFound)
+			return
+		}
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+// matchesFilter evaluates a filter of `field=="value"` terms joined by `and`.
+func matchesFilter(obj map[string]interface{}, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, term := range strings.Split(filter, " and ") {
+		field, value, ok := strings.Cut(term, "==")
+		if !ok || fmt.Sprint(obj[field]) != strings.Trim(value, `"`) {
+			return false
+		}
+	}
+	return true
+}
+
+// newFakeBloxOneSolver returns a solver reading the API key from a fake Secret.
+func newFakeBloxOneSolver() *bloxoneSolver {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bloxone-creds", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"api-key": []byte("api-key-1\n")},
+	}
+	return &bloxoneSolver{common: &customDNSProviderSolver{client: fake.NewClientset(secret)}}
+}
+
+// bloxOneChallenge builds a ChallengeRequest pointing at the fake API. extra
+// is merged into the solver config.
+func bloxOneChallenge(t *testing.T, f *fakeBloxOne, fqdn, zone, key string, extra map[string]interface{}) *whapi.ChallengeRequest {
+	t.Helper()
+	cfg := map[string]interface{}{
+		"host":            f.server.URL,
+		"apiKeySecretRef": map[string]string{"name": "bloxone-creds", "key": "api-key"},
+	}
+	for k, v := range extra {
+		cfg[k] = v
+	}
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	return &whapi.ChallengeRequest{
+		ResolvedFQDN:      fqdn,
+		ResolvedZone:      zone,
+		Key:               key,
+		ResourceNamespace: "test-namespace",
+		Config:            &apiextensionsv1.JSON{Raw: raw},
+	}
+}
+
+// TestBloxOne_PresentCleanUp verifies records are created once in the auth
+// zone and only the challenge's value is deleted
+func TestBloxOne_PresentCleanUp(t *testing.T) {
+	f := newFakeBloxOne(t)
+	zoneID := f.add("dns/auth_zone", map[string]interface{}{"fqdn": "example.com.", "view": "dns/view/1"})
+	solver := newFakeBloxOneSolver()
+	ch := bloxOneChallenge(t, f, "_acme-challenge.App.example.com.", "example.com.", "key-1", map[string]interface{}{"ttl": 60, "useTtl": true})
+	sibling := bloxOneChallenge(t, f, "_acme-challenge.app.example.com.", "example.com.", "key-2", nil)
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(sibling))
+
+	records := f.records()
+	require.Len(t, records, 2)
+	assert.Equal(t, 2, f.requests["POST dns/record"])
+	for _, record := range records {
+		assert.Equal(t, zoneID, record["zone"])
+		assert.Equal(t, "_acme-challenge.app", record["name_in_zone"])
+		assert.Equal(t, "TXT", record["type"])
+	}
+
+	require.NoError(t, solver.CleanUp(ch))
+	require.NoError(t, solver.CleanUp(ch))
+	records = f.records()
+	require.Len(t, records, 1)
+	assert.Equal(t, map[string]interface{}{"text": "key-2"}, records[0]["rdata"])
+}
+
+// TestBloxOne_View verifies the configured view selects among zones with the
+// same name and an ambiguous zone is reported
+func TestBloxOne_View(t *testing.T) {
+	f := newFakeBloxOne(t)
+	internal := f.add("dns/view", map[string]interface{}{"name": "internal"})
+	f.add("dns/auth_zone", map[string]interface{}{"fqdn": "example.com.", "view": "dns/view/default"})
+	zoneID := f.add("dns/auth_zone", map[string]interface{}{"fqdn": "example.com.", "view": internal})
+	solver := newFakeBloxOneSolver()
+
+	err := solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "set view")
+
+	require.NoError(t, solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", map[string]interface{}{"view": "internal"})))
+	records := f.records()
+	require.Len(t, records, 1)
+	assert.Equal(t, zoneID, records[0]["zone"])
+	assert.Equal(t, "_acme-challenge", records[0]["name_in_zone"])
+}
+
+// TestBloxOne_IgnoresWebhookDefaults verifies the WAPI webhook defaults and
+// their override policy do not apply to bloxone-ddi challenges
+func TestBloxOne_IgnoresWebhookDefaults(t *testing.T) {
+	useDefaults(t, "config:\n  host: gm.example.com\n  view: corp\nallowOverride: [ttl]\n")
+	f := newFakeBloxOne(t)
+	f.add("dns/auth_zone", map[string]interface{}{"fqdn": "example.com.", "view": "dns/view/1"})
+	solver := newFakeBloxOneSolver()
+
+	require.NoError(t, solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", nil)))
+	assert.Len(t, f.records(), 1)
+
+	cfg, err := loadBloxoneConfig(&apiextensionsv1.JSON{Raw: []byte(`{"apiKeySecretRef": {"name": "bloxone-creds", "key": "api-key"}}`)})
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Host, "the client should default to the Cloud Services Portal")
+	assert.Empty(t, cfg.View)
+}
+
+// TestBloxOne_Errors verifies configuration and API errors are reported
+func TestBloxOne_Errors(t *testing.T) {
+	f := newFakeBloxOne(t)
+	solver := newFakeBloxOneSolver()
+
+	err := solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "auth zone example.com not found")
+
+	err = solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", map[string]interface{}{"apiKeySecretRef": map[string]string{}}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "apiKeySecretRef is required")
+
+	err = solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", map[string]interface{}{"connectionRef": "prod-grid"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connectionRef is not supported by the bloxone-ddi solver")
+
+	relocation := []map[string]string{{"suffix": "example.com", "zone": "acme.example.net"}}
+	err = solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", map[string]interface{}{"challengeRelocation": relocation}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "challengeRelocation is not supported by the bloxone-ddi solver")
+
+	err = solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", map[string]interface{}{"sharedRecordGroup": "acme"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sharedRecordGroup is not supported by the bloxone-ddi solver")
+	assert.Empty(t, f.records())
+
+	wrongKey := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bloxone-creds", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"api-key": []byte("wrong")},
+	}
+	solver = &bloxoneSolver{common: &customDNSProviderSolver{client: fake.NewClientset(wrongKey)}}
+	err = solver.Present(bloxOneChallenge(t, f, "_acme-challenge.example.com.", "example.com.", "key-1", nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+}
+
+// TestBloxoneNameInZone verifies names are made relative to the zone
+func TestBloxoneNameInZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    string
+		want    string
+		wantErr bool
+	}{
+		{name: "_acme-challenge.app.example.com", zone: "example.com.", want: "_acme-challenge.app"},
+		{name: "example.com", zone: "example.com.", want: ""},
+		{name: "_acme-challenge.notexample.com", zone: "example.com.", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bloxoneNameInZone(tt.name, tt.zone)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
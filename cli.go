@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// subcommand is a CLI helper run instead of the webhook server when its name
+// is the first argument.
+type subcommand struct {
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+// subcommands lists the CLI helpers by name.
+var subcommands = map[string]subcommand{
+	"delegate": {
+		usage: "Create, verify or remove _acme-challenge CNAME delegations in Infoblox",
+		run:   runDelegate,
+	},
+	"relocation-cnames": {
+		usage: "Print the CNAMEs needed for domains to use their challengeRelocation names",
+		run:   runRelocationCNAMEs,
+	},
+}
+
+// runSubcommand runs the subcommand named by the first non-flag argument, if
+// any, and reports whether one was found. Flags before it are skipped, since
+// the image's entrypoint always passes -v.
+func runSubcommand(args []string) bool {
+	name, rest := splitSubcommand(args)
+	if name == "help" {
+		printSubcommands(os.Stdout)
+		return true
+	}
+	cmd, ok := subcommands[name]
+	if !ok {
+		return false
+	}
+
+	if err := cmd.run(rest, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// splitSubcommand returns the first argument not starting with "-" and the
+// arguments after it.
+func splitSubcommand(args []string) (string, []string) {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return arg, args[i+1:]
+		}
+	}
+	return "", nil
+}
+
+// printSubcommands lists the subcommands and their usage.
+func printSubcommands(out io.Writer) {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "Subcommands (run without one to start the webhook server):")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-20s %s\n", name, subcommands[name].usage)
+	}
+}
+
+// loadConfigFile reads a solver config, the `config` block of the issuer's
+// webhook solver, from a YAML or JSON file.
+func loadConfigFile(path string) (customDNSProviderConfig, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // G304: path is chosen by the operator running the CLI
+	if err != nil {
+		return customDNSProviderConfig{}, fmt.Errorf("CMI: Error reading config file: %w", err)
+	}
+	cfgJSON, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return customDNSProviderConfig{}, fmt.Errorf("CMI: Error parsing config file %s: %w", path, err)
+	}
+	return loadConfig(&apiextensionsv1.JSON{Raw: cfgJSON}, nil)
+}
+
+// runRelocationCNAMEs prints, for every domain given, the CNAME from its
+// challenge name to the relocated name in zone file notation.
+func runRelocationCNAMEs(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("relocation-cnames", flag.ContinueOnError)
+	configPath := flags.String("config", "", "Solver config file (YAML or JSON) with a challengeRelocation block")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: relocation-cnames -config <file> <domain>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("a config file and at least one domain are required")
+	}
+
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+	if len(cfg.ChallengeRelocation) == 0 {
+		return fmt.Errorf("config file %s has no challengeRelocation rules", *configPath)
+	}
+
+	var unmatched []string
+	for _, domain := range flags.Args() {
+		cname, ok := relocationCNAME(cfg.ChallengeRelocation, domain)
+		if !ok {
+			unmatched = append(unmatched, domain)
+			continue
+		}
+		fmt.Fprintln(out, cname)
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("no challengeRelocation rule matches %s", strings.Join(unmatched, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+// defaultCmpType is the CMP Type recorded on cloud records when cmpType is
+// not configured.
+const defaultCmpType = "cert-manager"
+
+// Extensible attributes the Cloud Network Automation API requires on objects
+// created by cloud users.
+const (
+	eaTenantID      = "Tenant ID"
+	eaCmpType       = "CMP Type"
+	eaCloudAPIOwned = "Cloud API Owned"
+)
+
+// cloudConfig enables Cloud Network Automation mode, in which records are
+// created through an ibclient object manager for a cloud management
+// platform and tenant, and carry the extensible attributes the Grid's Cloud
+// API rules require.
+type cloudConfig struct {
+	CmpType  string `json:"cmpType"`
+	TenantID string `json:"tenantID"`
+}
+
+// validateCloud checks the cloud block and defaults its cmpType. Cloud
+// records are created by the object manager, which supports neither shared
+// records nor a creator, so those options are rejected.
+func validateCloud(cfg *customDNSProviderConfig) error {
+	if cfg.Cloud == nil {
+		return nil
+	}
+	if cfg.Cloud.TenantID == "" {
+		return fmt.Errorf("CMI: cloud.tenantID is required in cloud mode")
+	}
+	if cfg.Cloud.CmpType == "" {
+		cfg.Cloud.CmpType = defaultCmpType
+	}
+	if cfg.SharedRecordGroup != "" {
+		return fmt.Errorf("CMI: cloud mode cannot be used with sharedRecordGroup")
+	}
+	if cfg.DynamicRecords {
+		return fmt.Errorf("CMI: cloud mode cannot be used with dynamicRecords")
+	}
+	return nil
+}
+
+// cloudEAs returns the extensible attributes of a record owned by the cloud
+// tenant.
+func cloudEAs(cloud *cloudConfig) ibclient.EA {
+	return ibclient.EA{
+		eaTenantID:      cloud.TenantID,
+		eaCmpType:       cloud.CmpType,
+		eaCloudAPIOwned: ibclient.Bool(true),
+	}
+}
+
+// createCloudTXTRecord creates a TXT record through an object manager for the
+// configured cloud management platform and tenant.
+func (c *customDNSProviderSolver) createCloudTXTRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string) (string, error) {
+	klog.InfoS("CMI: Creating TXT record through the cloud object manager", "name", name, "cmpType", cfg.Cloud.CmpType, "tenantID", cfg.Cloud.TenantID)
+
+	objMgr := ibclient.NewObjectManager(ib, cfg.Cloud.CmpType, cfg.Cloud.TenantID)
+	record, err := objMgr.CreateTXTRecord(cfg.View, name, text, cfg.TTL, cfg.UseTTL, cfg.comment, cloudEAs(cfg.Cloud))
+	if err != nil {
+		return "", err
+	}
+	return record.Ref, nil
+}
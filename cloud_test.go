@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateCloud verifies the cloud block's required fields, its cmpType
+// default and the options cloud mode cannot be combined with
+func TestValidateCloud(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         customDNSProviderConfig
+		wantCmpType string
+		wantErr     string
+	}{
+		{name: "disabled"},
+		{name: "default cmp type", cfg: customDNSProviderConfig{Cloud: &cloudConfig{TenantID: "tenant-1"}}, wantCmpType: defaultCmpType},
+		{name: "custom cmp type", cfg: customDNSProviderConfig{Cloud: &cloudConfig{TenantID: "tenant-1", CmpType: "OpenShift"}}, wantCmpType: "OpenShift"},
+		{name: "missing tenant", cfg: customDNSProviderConfig{Cloud: &cloudConfig{CmpType: "OpenShift"}}, wantErr: "tenantID is required"},
+		{name: "shared record group", cfg: customDNSProviderConfig{Cloud: &cloudConfig{TenantID: "tenant-1"}, SharedRecordGroup: "acme"}, wantErr: "sharedRecordGroup"},
+		{name: "dynamic records", cfg: customDNSProviderConfig{Cloud: &cloudConfig{TenantID: "tenant-1"}, DynamicRecords: true}, wantErr: "dynamicRecords"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCloud(&tt.cfg)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.cfg.Cloud != nil {
+				assert.Equal(t, tt.wantCmpType, tt.cfg.Cloud.CmpType)
+			}
+		})
+	}
+}
+
+// TestPresentCleanUp_CloudMode verifies cloud records are created with the
+// tenant and CMP type EAs, bypassing batched creates, and cleaned up as usual
+func TestPresentCleanUp_CloudMode(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{
+		"view":          "default",
+		"version":       "2.10",
+		"batchRequests": true,
+		"cloud":         map[string]string{"cmpType": "OpenShift", "tenantID": "tenant-1"},
+	})
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(ch))
+
+	records := f.find("record:txt", map[string]string{"name": "_acme-challenge.app.example.com", "text": "key-1"})
+	require.Len(t, records, 1)
+	assert.Equal(t, map[string]interface{}{
+		eaTenantID:      map[string]interface{}{"value": "tenant-1"},
+		eaCmpType:       map[string]interface{}{"value": "OpenShift"},
+		eaCloudAPIOwned: map[string]interface{}{"value": "True"},
+	}, records[0]["extattrs"])
+	assert.Equal(t, 1, f.count("POST record:txt"))
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("record:txt", nil))
+}
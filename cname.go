@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// maxCNAMEDepth bounds how many CNAMEs are followed from a challenge name.
+const maxCNAMEDepth = 8
+
+// followCNAMEs returns the name the TXT record for name must live at. A TXT
+// record cannot coexist with a CNAME, so when name is a record:cname in view,
+// the alias is followed to its canonical name, and so on until a name without
+// a CNAME is reached. Chains that loop or are longer than maxCNAMEDepth are
+// an error.
+func (c *customDNSProviderSolver) followCNAMEs(ib ibclient.IBConnector, name, view string) (string, error) {
+	seen := map[string]bool{strings.ToLower(name): true}
+	current := name
+	for depth := 0; ; depth++ {
+		target, err := getCNAMETarget(ib, current, view)
+		if err != nil {
+			return "", fmt.Errorf("CMI: Error looking up CNAME for %s: %w", current, err)
+		}
+		if target == "" {
+			if current != name {
+				klog.InfoS("CMI: Followed CNAME for challenge name", "name", name, "target", current, "view", view)
+			}
+			return current, nil
+		}
+
+		if depth+1 > maxCNAMEDepth {
+			return "", fmt.Errorf("CMI: CNAME chain from %s is longer than %d records", name, maxCNAMEDepth)
+		}
+		if seen[strings.ToLower(target)] {
+			return "", fmt.Errorf("CMI: CNAME loop from %s detected at %s", name, target)
+		}
+		seen[strings.ToLower(target)] = true
+		klog.InfoS("CMI: Challenge name is an alias", "name", current, "canonical", target)
+		current = target
+	}
+}
+
+// getCNAMETarget returns the canonical name of the record:cname at name in
+// view, or an empty string when there is none.
+func getCNAMETarget(ib ibclient.IBConnector, name, view string) (string, error) {
+	records, err := getCNAMEs(ib, name, view)
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+	return strings.TrimSuffix(ptr.Deref(records[0].Canonical, ""), "."), nil
+}
+
+// getCNAMEs returns the record:cname objects at name in view.
+func getCNAMEs(ib ibclient.IBConnector, name, view string) ([]ibclient.RecordCNAME, error) {
+	var records []ibclient.RecordCNAME
+	params := map[string]string{
+		"name": name,
+		"view": view,
+	}
+	err := ib.GetObject(ibclient.NewEmptyRecordCNAME(), "", ibclient.NewQueryParams(false, params), &records)
+
+	var notFoundErr *ibclient.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, nil
+	}
+	return records, err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addCNAME stores a record:cname in the default view of the fake WAPI.
+func addCNAME(f *fakeWAPI, name, canonical string) {
+	f.add("record:cname", map[string]interface{}{"name": name, "canonical": canonical, "view": "default"})
+}
+
+// TestFollowCNAMEs verifies CNAME chains are followed to their end and loops
+// and overly long chains are rejected
+func TestFollowCNAMEs(t *testing.T) {
+	tests := []struct {
+		name    string
+		cnames  [][2]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no cname",
+			want: "_acme-challenge.app.example.com",
+		},
+		{
+			name:   "single alias",
+			cnames: [][2]string{{"_acme-challenge.app.example.com", "app.acme.example.net"}},
+			want:   "app.acme.example.net",
+		},
+		{
+			name: "chain with trailing dot",
+			cnames: [][2]string{
+				{"_acme-challenge.app.example.com", "_acme-challenge.example.org"},
+				{"_acme-challenge.example.org", "app.acme.example.net."},
+			},
+			want: "app.acme.example.net",
+		},
+		{
+			name: "loop",
+			cnames: [][2]string{
+				{"_acme-challenge.app.example.com", "a.example.net"},
+				{"a.example.net", "_ACME-CHALLENGE.app.example.com"},
+			},
+			wantErr: "CNAME loop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			solver := newFakeWAPISolver()
+			ib, cfg := fakeWAPIConnector(t, f, solver)
+			for _, cname := range tt.cnames {
+				addCNAME(f, cname[0], cname[1])
+			}
+			// An alias in another view must never be followed
+			f.add("record:cname", map[string]interface{}{"name": "_acme-challenge.app.example.com", "canonical": "elsewhere.example.net", "view": "internal"})
+
+			got, err := solver.followCNAMEs(ib, "_acme-challenge.app.example.com", cfg.View)
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestFollowCNAMEs_DepthLimit verifies chains longer than maxCNAMEDepth fail
+func TestFollowCNAMEs_DepthLimit(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ib, cfg := fakeWAPIConnector(t, f, solver)
+	for i := 0; i <= maxCNAMEDepth; i++ {
+		addCNAME(f, fmt.Sprintf("hop%d.example.net", i), fmt.Sprintf("hop%d.example.net", i+1))
+	}
+
+	_, err := solver.followCNAMEs(ib, "hop0.example.net", cfg.View)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "longer than")
+}
+
+// TestPresentCleanUp_FollowsCNAME verifies the TXT record is created and
+// deleted at the CNAME target instead of the alias
+func TestPresentCleanUp_FollowsCNAME(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	addCNAME(f, "_acme-challenge.app.example.com", "app.acme.example.net")
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{"view": "default", "version": "2.10"})
+
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", map[string]string{"name": "app.acme.example.net", "text": "key-1"}), 1)
+	assert.Empty(t, f.find("record:txt", map[string]string{"name": "_acme-challenge.app.example.com"}))
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("record:txt", nil))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// maxCommentLength is the longest comment WAPI accepts on a record.
+const maxCommentLength = 256
+
+// ClusterNameEnv names the environment variable holding the cluster name
+// offered to comment templates.
+const ClusterNameEnv = "CLUSTER_NAME"
+
+// commentData is what a commentTemplate is rendered with.
+type commentData struct {
+	// DNSName is the name being validated, e.g. app.example.com.
+	DNSName string
+	// ResourceNamespace is the namespace of the Issuer, or cert-manager's
+	// cluster resource namespace for a ClusterIssuer.
+	ResourceNamespace string
+	// UID identifies the ChallengeRequest.
+	UID string
+	// ResolvedFQDN and ResolvedZone are the challenge name and zone
+	// cert-manager resolved.
+	ResolvedFQDN string
+	ResolvedZone string
+	// RecordName is the name the TXT record is created at, after relocation
+	// and CNAMEs.
+	RecordName string
+	// View is the DNS view the record is created in.
+	View string
+	// GroupName is the webhook's API group.
+	GroupName string
+	// ClusterName is taken from the CLUSTER_NAME environment variable.
+	ClusterName string
+	// Created is the time the record is created.
+	Created time.Time
+}
+
+// parseCommentTemplate parses a commentTemplate and renders it once with
+// sample data, so unknown fields are reported when the config loads instead
+// of when a record is created.
+func parseCommentTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("commentTemplate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("CMI: Invalid commentTemplate: %w", err)
+	}
+	sample := commentData{
+		DNSName:           "app.example.com",
+		ResourceNamespace: "default",
+		UID:               "00000000-0000-0000-0000-000000000000",
+		ResolvedFQDN:      "_acme-challenge.app.example.com.",
+		ResolvedZone:      "example.com.",
+		RecordName:        "_acme-challenge.app.example.com",
+		View:              "default",
+		Created:           time.Now(),
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return nil, fmt.Errorf("CMI: Invalid commentTemplate: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderComment renders the configured commentTemplate for a challenge. A
+// template that fails to render, which the check at load time makes
+// unlikely, only costs the comment, not the record. Comments longer than
+// WAPI allows are truncated.
+func renderComment(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest, recordName string) string {
+	if cfg.commentTemplate == nil {
+		return ""
+	}
+	data := commentData{
+		DNSName:           ch.DNSName,
+		ResourceNamespace: ch.ResourceNamespace,
+		UID:               string(ch.UID),
+		ResolvedFQDN:      ch.ResolvedFQDN,
+		ResolvedZone:      ch.ResolvedZone,
+		RecordName:        recordName,
+		View:              cfg.View,
+		GroupName:         GroupName,
+		ClusterName:       os.Getenv(ClusterNameEnv),
+		Created:           time.Now().UTC(),
+	}
+
+	var out bytes.Buffer
+	if err := cfg.commentTemplate.Execute(&out, data); err != nil {
+		klog.InfoS("CMI: Error rendering commentTemplate, creating the record without a comment", "error", err.Error())
+		return ""
+	}
+	comment := []rune(out.String())
+	if len(comment) > maxCommentLength {
+		klog.InfoS("CMI: Rendered comment is too long, truncating", "length", len(comment), "max", maxCommentLength)
+		comment = comment[:maxCommentLength]
+	}
+	return string(comment)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseCommentTemplate verifies templates are checked for syntax and
+// unknown fields when the config loads
+func TestParseCommentTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantNil  bool
+		wantErr  string
+	}{
+		{name: "empty", wantNil: true},
+		{name: "fields", template: `cert-manager challenge for {{ .DNSName }} ({{ .ResourceNamespace }}) created {{ .Created.Format "2006-01-02" }}`},
+		{name: "syntax error", template: `{{ .DNSName `, wantErr: "Invalid commentTemplate"},
+		{name: "unknown field", template: `{{ .Issuer }}`, wantErr: "Invalid commentTemplate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseCommentTemplate(tt.template)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNil, tmpl == nil)
+		})
+	}
+}
+
+// TestRenderComment verifies the challenge and webhook settings reach the
+// template and long comments are truncated
+func TestRenderComment(t *testing.T) {
+	t.Setenv(ClusterNameEnv, "prod-east")
+	ch := &whapi.ChallengeRequest{UID: "1234", DNSName: "app.example.com", ResourceNamespace: "team-a"}
+
+	tmpl, err := parseCommentTemplate(`cert-manager challenge for {{ .DNSName }} ({{ .ResourceNamespace }}, cluster {{ .ClusterName }}) uid {{ .UID }} in {{ .View }}`)
+	require.NoError(t, err)
+	cfg := &customDNSProviderConfig{View: "default", commentTemplate: tmpl}
+	assert.Equal(t, "cert-manager challenge for app.example.com (team-a, cluster prod-east) uid 1234 in default", renderComment(cfg, ch, "_acme-challenge.app.example.com"))
+
+	tmpl, err = parseCommentTemplate(strings.Repeat("ü", 300))
+	require.NoError(t, err)
+	cfg.commentTemplate = tmpl
+	assert.Equal(t, strings.Repeat("ü", maxCommentLength), renderComment(cfg, ch, "_acme-challenge.app.example.com"))
+
+	assert.Empty(t, renderComment(&customDNSProviderConfig{}, ch, "_acme-challenge.app.example.com"))
+}
+
+// TestPresent_CommentTemplate verifies created records carry the rendered
+// comment and invalid templates fail before anything is created
+func TestPresent_CommentTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]interface{}
+		objType string
+	}{
+		{name: "two-step", extra: map[string]interface{}{}, objType: "record:txt"},
+		{name: "batched", extra: map[string]interface{}{"batchRequests": true}, objType: "record:txt"},
+		{name: "shared record", extra: map[string]interface{}{"sharedRecordGroup": "acme", "sharedRecordZone": "example.com"}, objType: "sharedrecord:txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			solver := newFakeWAPISolver()
+			tt.extra["view"] = "default"
+			tt.extra["version"] = "2.10"
+			tt.extra["commentTemplate"] = "challenge for {{ .DNSName }} in {{ .ResourceNamespace }}"
+			ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", tt.extra)
+			ch.DNSName = "app.example.com"
+
+			require.NoError(t, solver.Present(ch))
+
+			assert.Len(t, f.find(tt.objType, map[string]string{"text": "key-1", "comment": "challenge for app.example.com in test-namespace"}), 1)
+		})
+	}
+
+	f := newFakeWAPI(t)
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{"view": "default", "version": "2.10", "commentTemplate": "{{ .Nope }}"})
+	err := newFakeWAPISolver().Present(ch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid commentTemplate")
+	assert.Zero(t, f.count("POST record:txt"))
+}
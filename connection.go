@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// connectionGVR identifies the cluster-scoped InfobloxConnection resource
+// issuers reference with connectionRef.
+var connectionGVR = schema.GroupVersionResource{Group: "infoblox.sarg3.net", Version: "v1alpha1", Resource: "infobloxconnections"}
+
+// connectionProbeInterval is how often the Reachable condition of every
+// InfobloxConnection is refreshed.
+const connectionProbeInterval = 5 * time.Minute
+
+// Condition reported in InfobloxConnection status.
+const (
+	conditionReachable = "Reachable"
+	reasonConnected    = "Connected"
+	reasonUnreachable  = "Unreachable"
+	reasonInvalidSpec  = "InvalidSpec"
+)
+
+// connectionSpec is the spec of an InfobloxConnection: the Grid connection
+// settings issuers would otherwise repeat in their config. Its fields use the
+// same names as the config.
+type connectionSpec struct {
+	Host              string            `json:"host"`
+	Port              string            `json:"port"`
+	Version           string            `json:"version"`
+	View              string            `json:"view"`
+	SslVerify         bool              `json:"sslVerify"`
+	UsernameSecretRef secretKeySelector `json:"usernameSecretRef"`
+	PasswordSecretRef secretKeySelector `json:"passwordSecretRef"`
+}
+
+// connectionClient reads InfobloxConnections and reports their reachability.
+// A nil connectionClient, as used by the CLI, cannot resolve connectionRef.
+type connectionClient struct {
+	client dynamic.Interface
+	// lister serves InfobloxConnections from the cache started by watch once
+	// synced reports true. Without it they are read from the API server.
+	lister cache.GenericLister
+	synced cache.InformerSynced
+}
+
+// watch starts caching InfobloxConnections until stopCh is closed, so
+// challenges do not read their connection from the API server.
+func (cc *connectionClient) watch(stopCh <-chan struct{}) {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(cc.client, 0)
+	informer := factory.ForResource(connectionGVR)
+	cc.lister = informer.Lister()
+	cc.synced = informer.Informer().HasSynced
+	factory.Start(stopCh)
+}
+
+// get returns the named InfobloxConnection from the cache, or from the API
+// server until the cache has synced.
+func (cc *connectionClient) get(name string) (*unstructured.Unstructured, error) {
+	if cc.lister != nil && cc.synced() {
+		obj, err := cc.lister.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		connection, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object %T in the InfobloxConnection cache", obj)
+		}
+		return connection, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return cc.client.Resource(connectionGVR).Get(ctx, name, metav1.GetOptions{})
+}
+
+// spec returns the spec of the named InfobloxConnection as JSON, for the
+// issuer's config to be decoded over.
+func (cc *connectionClient) spec(name string) ([]byte, error) {
+	if cc == nil {
+		return nil, fmt.Errorf("CMI: connectionRef %s cannot be resolved without access to InfobloxConnections", name)
+	}
+	klog.InfoS("CMI: Getting InfobloxConnection", "name", name)
+	obj, err := cc.get(name)
+	if err != nil {
+		return nil, fmt.Errorf("CMI: Error getting InfobloxConnection %s: %w", name, err)
+	}
+	if _, err := decodeConnectionSpec(obj); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj.Object["spec"])
+}
+
+// decodeConnectionSpec converts the spec of an InfobloxConnection.
+func decodeConnectionSpec(obj *unstructured.Unstructured) (connectionSpec, error) {
+	var spec connectionSpec
+	raw, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err == nil {
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec)
+	}
+	if err != nil {
+		return spec, fmt.Errorf("CMI: Error decoding InfobloxConnection %s: %w", obj.GetName(), err)
+	}
+	if spec.Host == "" {
+		return spec, fmt.Errorf("CMI: InfobloxConnection %s has no host", obj.GetName())
+	}
+	return spec, nil
+}
+
+// run refreshes the Reachable condition of every InfobloxConnection until
+// stopCh is closed.
+func (cc *connectionClient) run(stopCh <-chan struct{}) {
+	wait.Until(cc.probeAll, connectionProbeInterval, stopCh)
+}
+
+// probeAll probes every InfobloxConnection and updates its status.
+func (cc *connectionClient) probeAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	list, err := cc.client.Resource(connectionGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		klog.InfoS("CMI: Error listing InfobloxConnections", "error", err.Error())
+		return
+	}
+	for i := range list.Items {
+		cc.probe(&list.Items[i])
+	}
+}
+
+// probe checks that the Grid of one InfobloxConnection is reachable and
+// records the result in its Reachable condition.
+func (cc *connectionClient) probe(obj *unstructured.Unstructured) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cond := metav1.Condition{Type: conditionReachable, Status: metav1.ConditionTrue, Reason: reasonConnected, Message: "WAPI answered"}
+	spec, err := decodeConnectionSpec(obj)
+	if err != nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, reasonInvalidSpec, err.Error()
+	} else if err := probeConnection(ctx, &spec); err != nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, reasonUnreachable, err.Error()
+	}
+	klog.InfoS("CMI: Probed InfobloxConnection", "name", obj.GetName(), "reachable", cond.Status)
+
+	if err := cc.setCondition(ctx, obj, cond); err != nil {
+		klog.InfoS("CMI: Error updating InfobloxConnection status", "name", obj.GetName(), "error", err.Error())
+	}
+}
+
+// setCondition writes cond to the status of obj, unless it is already there.
+// Every replica probes, so a conflict means another one wrote the status in
+// the meantime; the write is then retried on top of theirs.
+func (cc *connectionClient) setCondition(ctx context.Context, obj *unstructured.Unstructured, cond metav1.Condition) error {
+	resource := cc.client.Resource(connectionGVR)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		changed, err := withCondition(obj, cond)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = resource.UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			latest, getErr := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			obj = latest
+		}
+		return err
+	})
+}
+
+// withCondition sets cond in the status of obj and reports whether that
+// changed it.
+func withCondition(obj *unstructured.Unstructured, cond metav1.Condition) (bool, error) {
+	var status struct {
+		Conditions []metav1.Condition `json:"conditions,omitempty"`
+	}
+	if raw, ok, _ := unstructured.NestedMap(obj.Object, "status"); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+			return false, err
+		}
+	}
+	cond.ObservedGeneration = obj.GetGeneration()
+	if !apimeta.SetStatusCondition(&status.Conditions, cond) {
+		return false, nil
+	}
+
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return false, err
+	}
+	obj.Object["status"] = raw
+	return true, nil
+}
+
+// probeConnection checks that WAPI answers on the connection's host and
+// port. No credentials are sent, so any HTTP response, including 401, counts
+// as reachable.
+func probeConnection(ctx context.Context, spec *connectionSpec) error {
+	port := spec.Port
+	if port == "" {
+		port = "443"
+	}
+	u := url.URL{Scheme: "https", Host: spec.Host + ":" + port, Path: "/wapi/v" + schemaProbeVersion + "/", RawQuery: "_schema"}
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Mirrors the ibclient transport, which only verifies when sslVerify is set.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !spec.SslVerify}, //nolint:gosec // G402: controlled by sslVerify
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: 30 * time.Second,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
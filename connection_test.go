@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newConnection builds an InfobloxConnection with the given spec.
+func newConnection(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: connectionGVR.Group, Version: connectionGVR.Version, Kind: "InfobloxConnection"})
+	obj.SetName(name)
+	return obj
+}
+
+// newConnectionClient returns a connectionClient backed by a fake dynamic
+// client holding objs.
+func newConnectionClient(objs ...runtime.Object) *connectionClient {
+	listKinds := map[schema.GroupVersionResource]string{connectionGVR: "InfobloxConnectionList"}
+	return &connectionClient{client: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objs...)}
+}
+
+// TestLoadConfig_ConnectionRef verifies a referenced InfobloxConnection
+// provides the connection settings and the issuer's config overrides them
+func TestLoadConfig_ConnectionRef(t *testing.T) {
+	connections := newConnectionClient(newConnection("prod-grid", map[string]interface{}{
+		"host":              "gm.example.com",
+		"version":           "2.12",
+		"view":              "default",
+		"sslVerify":         true,
+		"usernameSecretRef": map[string]interface{}{"name": "infoblox-creds", "key": "username"},
+		"passwordSecretRef": map[string]interface{}{"name": "infoblox-creds", "key": "password"},
+	}))
+
+	tests := []struct {
+		name    string
+		config  string
+		check   func(t *testing.T, cfg customDNSProviderConfig)
+		wantErr string
+	}{
+		{
+			name:   "connection settings",
+			config: `{"connectionRef": "prod-grid", "ttl": 60}`,
+			check: func(t *testing.T, cfg customDNSProviderConfig) {
+				assert.Equal(t, "gm.example.com", cfg.Host)
+				assert.Equal(t, "443", cfg.Port)
+				assert.Equal(t, "2.12", cfg.Version)
+				assert.Equal(t, "default", cfg.View)
+				assert.True(t, cfg.SslVerify)
+				assert.Equal(t, "infoblox-creds", cfg.PasswordSecretRef.Name)
+				assert.Equal(t, uint32(60), cfg.TTL)
+			},
+		},
+		{
+			name:   "issuer overrides",
+			config: `{"connectionRef": "prod-grid", "view": "internal", "sslVerify": false, "usernameSecretRef": {"name": "team-creds", "key": "user"}}`,
+			check: func(t *testing.T, cfg customDNSProviderConfig) {
+				assert.Equal(t, "gm.example.com", cfg.Host)
+				assert.Equal(t, "internal", cfg.View)
+				assert.False(t, cfg.SslVerify)
+				assert.Equal(t, "team-creds", cfg.UsernameSecretRef.Name)
+				assert.Equal(t, "infoblox-creds", cfg.PasswordSecretRef.Name)
+			},
+		},
+		{name: "missing connection", config: `{"connectionRef": "staging-grid"}`, wantErr: "Error getting InfobloxConnection staging-grid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte(tt.config)}, connections)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+
+	_, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte(`{"connectionRef": "prod-grid"}`)}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be resolved")
+}
+
+// TestConnectionProbe verifies the Reachable condition reflects whether WAPI
+// answers on each InfobloxConnection's host
+func TestConnectionProbe(t *testing.T) {
+	f := newFakeWAPI(t)
+	host, port := f.hostPort()
+	deadHost, deadPort := unreachableAddr(t)
+	connections := newConnectionClient(
+		newConnection("up", map[string]interface{}{"host": host, "port": port}),
+		newConnection("down", map[string]interface{}{"host": deadHost, "port": deadPort}),
+		newConnection("invalid", map[string]interface{}{"port": port}),
+	)
+
+	connections.probeAll()
+
+	want := map[string]string{"up": reasonConnected, "down": reasonUnreachable, "invalid": reasonInvalidSpec}
+	for name, reason := range want {
+		obj, err := connections.client.Resource(connectionGVR).Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		var status struct {
+			Conditions []metav1.Condition `json:"conditions"`
+		}
+		raw, _, _ := unstructured.NestedMap(obj.Object, "status")
+		require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status))
+
+		cond := apimeta.FindStatusCondition(status.Conditions, conditionReachable)
+		require.NotNil(t, cond, name)
+		assert.Equal(t, reason, cond.Reason, name)
+		assert.Equal(t, reason == reasonConnected, cond.Status == metav1.ConditionTrue, name)
+	}
+}
+
+// TestConnections_Watch verifies connections are served from the cache once
+// it has synced
+func TestConnections_Watch(t *testing.T) {
+	connections := newConnectionClient(newConnection("prod-grid", map[string]interface{}{"host": "gm.example.com"}))
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	connections.watch(stopCh)
+	require.True(t, cache.WaitForCacheSync(stopCh, connections.synced))
+
+	fakeClient := connections.client.(*dynamicfake.FakeDynamicClient)
+	fakeClient.ClearActions()
+	spec, err := connections.spec("prod-grid")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"host": "gm.example.com"}`, string(spec))
+
+	_, err = connections.spec("staging-grid")
+	require.Error(t, err)
+	assert.Empty(t, fakeClient.Actions(), "connections should not be read from the API server")
+}
+
+// TestConnectionProbe_Conflict verifies a status write that conflicts with
+// another replica's is retried, and an unchanged condition is not written
+func TestConnectionProbe_Conflict(t *testing.T) {
+	f := newFakeWAPI(t)
+	host, port := f.hostPort()
+	connections := newConnectionClient(newConnection("up", map[string]interface{}{"host": host, "port": port}))
+	fakeClient := connections.client.(*dynamicfake.FakeDynamicClient)
+	conflicts := 1
+	fakeClient.PrependReactor("update", "infobloxconnections", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(connectionGVR.GroupResource(), "up", errors.New("the object has been modified"))
+	})
+
+	connections.probeAll()
+	obj, err := connections.client.Resource(connectionGVR).Get(context.Background(), "up", metav1.GetOptions{})
+	require.NoError(t, err)
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	assert.Len(t, conditions, 1)
+	assert.Zero(t, conflicts, "the conflicting write should have been retried")
+
+	fakeClient.ClearActions()
+	connections.probe(obj)
+	for _, action := range fakeClient.Actions() {
+		assert.NotEqual(t, "update", action.GetVerb(), "an unchanged condition should not be written")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/klog/v2"
+)
+
+// DefaultsFileEnv names the environment variable holding the path of the
+// webhook defaults file, usually mounted from a ConfigMap.
+const DefaultsFileEnv = "DEFAULTS_FILE"
+
+// defaultableFields are the config fields the defaults file may set.
+var defaultableFields = map[string]bool{
+	"host":              true,
+	"port":              true,
+	"version":           true,
+	"view":              true,
+	"sslVerify":         true,
+	"caBundle":          true,
+	"ttl":               true,
+	"useTtl":            true,
+	"usernameSecretRef": true,
+	"passwordSecretRef": true,
+	"getUserFromVolume": true,
+}
+
+// webhookDefaults is the decoded defaults file, layered under every issuer's
+// config.
+type webhookDefaults struct {
+	// Config holds the defaults, in the same form as an issuer's config.
+	Config map[string]json.RawMessage `json:"config"`
+	// AllowOverride lists the defaulted fields issuers may set themselves.
+	// When it is not set, issuers may override every field.
+	AllowOverride *[]string `json:"allowOverride"`
+
+	// raw is Config encoded once for decoding under each issuer's config.
+	raw []byte
+}
+
+// webhookDefaultsFile is the defaults file named by DEFAULTS_FILE, if any.
+var webhookDefaultsFile = &reloadingFile[webhookDefaults]{path: os.Getenv(DefaultsFileEnv), what: "defaults file", read: readDefaults}
+
+// readDefaults reads and validates a defaults file in YAML or JSON.
+func readDefaults(path string) (*webhookDefaults, error) {
+	defaults := &webhookDefaults{}
+	if err := decodeFile(path, "defaults file", defaults); err != nil {
+		return nil, err
+	}
+
+	fields := sortedKeys(defaults.Config)
+	if defaults.AllowOverride != nil {
+		fields = append(fields, *defaults.AllowOverride...)
+	}
+	for _, field := range fields {
+		if !defaultableFields[field] {
+			return nil, fmt.Errorf("CMI: Field %q cannot be set in the defaults file", field)
+		}
+	}
+
+	raw, err := json.Marshal(defaults.Config)
+	if err != nil {
+		return nil, err
+	}
+	defaults.raw = raw
+	if err := json.Unmarshal(defaults.raw, &customDNSProviderConfig{}); err != nil {
+		return nil, fmt.Errorf("CMI: Error decoding defaults file %s: %w", path, err)
+	}
+	klog.InfoS("CMI: Loaded defaults file", "path", path, "fields", sortedKeys(defaults.Config), "allowOverride", defaults.AllowOverride)
+	return defaults, nil
+}
+
+// checkOverrides rejects fields of raw, a config from source, that the
+// defaults set and do not allow issuers to override.
+func (d *webhookDefaults) checkOverrides(source string, raw []byte) error {
+	if d == nil || d.AllowOverride == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		// Reported when the config is decoded.
+		return nil
+	}
+
+	// Keys are compared case-insensitively, as json.Unmarshal matches them.
+	defaulted := make(map[string]bool, len(d.Config))
+	for field := range d.Config {
+		defaulted[strings.ToLower(field)] = true
+	}
+	allowed := make(map[string]bool, len(*d.AllowOverride))
+	for _, field := range *d.AllowOverride {
+		allowed[strings.ToLower(field)] = true
+	}
+	var locked []string
+	for _, field := range sortedKeys(fields) {
+		if key := strings.ToLower(field); defaulted[key] && !allowed[key] {
+			locked = append(locked, field)
+		}
+	}
+	if len(locked) > 0 {
+		return fmt.Errorf("CMI: %s may not override %v, set by the webhook defaults", source, locked)
+	}
+	return nil
+}
+
+// decodeConfig decodes the layers of a solver config: the webhook defaults,
+// then the InfobloxConnection named by connectionRef, then the issuer's own
+// config, each overriding the fields it sets. Only the issuer's config is
+// held to the defaults' override policy; connections are admin-owned.
+func decodeConfig(cfgJSON *apiextensionsv1.JSON, connections *connectionClient) (customDNSProviderConfig, error) {
+	cfg := customDNSProviderConfig{}
+	defaults, err := webhookDefaultsFile.get()
+	if err != nil {
+		return cfg, err
+	}
+	if defaults != nil {
+		if err := json.Unmarshal(defaults.raw, &cfg); err != nil {
+			return cfg, fmt.Errorf("CMI: Error decoding defaults: %w", err)
+		}
+	}
+
+	if err := overlayConfig(&cfg, "solver config", cfgJSON.Raw, defaults); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnectionRef == "" {
+		return cfg, nil
+	}
+	spec, err := connections.spec(cfg.ConnectionRef)
+	if err != nil {
+		return cfg, err
+	}
+	if err := overlayConfig(&cfg, "InfobloxConnection "+cfg.ConnectionRef, spec, nil); err != nil {
+		return cfg, err
+	}
+	// The issuer's own fields override the connection's.
+	return cfg, overlayConfig(&cfg, "solver config", cfgJSON.Raw, nil)
+}
+
+// overlayConfig decodes raw, a config from source, over cfg once the
+// defaults' override policy allows it.
+func overlayConfig(cfg *customDNSProviderConfig, source string, raw []byte, defaults *webhookDefaults) error {
+	if err := defaults.checkOverrides(source, raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return fmt.Errorf("CMI: Error decoding %s: %w", source, err)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, for stable logs and errors.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
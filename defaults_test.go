@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// useDefaults installs a defaults file with the given content for the
+// duration of the test and returns its path.
+func useDefaults(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "defaults.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	previous := webhookDefaultsFile
+	webhookDefaultsFile = &reloadingFile[webhookDefaults]{path: path, what: "defaults file", read: readDefaults}
+	t.Cleanup(func() { webhookDefaultsFile = previous })
+	return path
+}
+
+// TestReadDefaults verifies the defaults file is validated when it is read
+func TestReadDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "valid", content: "config:\n  host: gm.example.com\n  ttl: 60\nallowOverride: [view]\n"},
+		{name: "unknown key", content: "defaults:\n  host: gm.example.com\n", wantErr: "unknown field"},
+		{name: "field not defaultable", content: "config:\n  batchRequests: true\n", wantErr: `"batchRequests" cannot be set`},
+		{name: "override not defaultable", content: "allowOverride: [cloud]\n", wantErr: `"cloud" cannot be set`},
+		{name: "wrong type", content: "config:\n  ttl: soon\n", wantErr: "Error decoding defaults file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "defaults.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			_, err := readDefaults(path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestLoadConfig_Defaults verifies the defaults are layered under the
+// connection and issuer config, and allowOverride limits what issuers, but
+// not connections, change
+func TestLoadConfig_Defaults(t *testing.T) {
+	useDefaults(t, `
+config:
+  host: gm.example.com
+  view: default
+  ttl: 60
+  sslVerify: true
+allowOverride: [view, host]
+`)
+	connections := newConnectionClient(
+		newConnection("new-grid", map[string]interface{}{"host": "new-gm.example.com"}),
+		newConnection("lax-grid", map[string]interface{}{"host": "new-gm.example.com", "sslVerify": false}),
+	)
+
+	tests := []struct {
+		name    string
+		config  string
+		want    customDNSProviderConfig
+		wantErr string
+	}{
+		{name: "defaults", config: `{}`, want: customDNSProviderConfig{Host: "gm.example.com", View: "default", TTL: 60, SslVerify: true}},
+		{name: "allowed override", config: `{"view": "internal"}`, want: customDNSProviderConfig{Host: "gm.example.com", View: "internal", TTL: 60, SslVerify: true}},
+		{name: "connection", config: `{"connectionRef": "new-grid", "view": "internal"}`, want: customDNSProviderConfig{Host: "new-gm.example.com", View: "internal", TTL: 60, SslVerify: true}},
+		{name: "locked field", config: `{"ttl": 300, "sslVerify": false}`, wantErr: "solver config may not override [sslVerify ttl]"},
+		{name: "locked field in other case", config: `{"SslVerify": false, "TTL": 300}`, wantErr: "solver config may not override [SslVerify TTL]"},
+		{name: "allowed override in other case", config: `{"View": "internal"}`, want: customDNSProviderConfig{Host: "gm.example.com", View: "internal", TTL: 60, SslVerify: true}},
+		{name: "locked field in connection", config: `{"connectionRef": "lax-grid"}`, want: customDNSProviderConfig{Host: "new-gm.example.com", View: "default", TTL: 60}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte(tt.config)}, connections)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Host, cfg.Host)
+			assert.Equal(t, tt.want.View, cfg.View)
+			assert.Equal(t, tt.want.TTL, cfg.TTL)
+			assert.Equal(t, tt.want.SslVerify, cfg.SslVerify)
+		})
+	}
+}
+
+// TestDefaultsFile_Reload verifies a changed defaults file is picked up and
+// an invalid one keeps the previous defaults
+func TestDefaultsFile_Reload(t *testing.T) {
+	path := useDefaults(t, "config:\n  ttl: 60\n")
+	load := func() customDNSProviderConfig {
+		cfg, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte(`{}`)}, nil)
+		require.NoError(t, err)
+		return cfg
+	}
+	assert.Equal(t, uint32(60), load().TTL)
+
+	require.NoError(t, os.WriteFile(path, []byte("config:\n  ttl: 120\n"), 0o600))
+	assert.Equal(t, uint32(120), load().TTL)
+
+	require.NoError(t, os.WriteFile(path, []byte("config:\n  cloud: {}\n"), 0o600))
+	assert.Equal(t, uint32(120), load().TTL)
+}
+
+// TestPresent_CABundle verifies the Grid certificate is verified against a
+// configured caBundle
+func TestPresent_CABundle(t *testing.T) {
+	f := newFakeWAPI(t)
+	bundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.server.Certificate().Raw}))
+	solver := newFakeWAPISolver()
+
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "default", "caBundle": bundle})
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", nil), 1)
+
+	// httptest servers share one certificate, so sign an unrelated one
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "other-ca"}, NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	otherBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	ch = fakeChallenge(t, f, "_acme-challenge.example.com.", "key-2", map[string]interface{}{"view": "default", "caBundle": otherBundle})
+	err = solver.Present(ch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+
+	_, err = loadConfig(&apiextensionsv1.JSON{Raw: []byte(`{"caBundle": "not a certificate"}`)}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no PEM certificates")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/ptr"
+)
+
+// delegationComment marks CNAME records created by the delegate subcommand.
+const delegationComment = "ACME challenge delegation managed by cert-manager-webhook-infoblox-wapi"
+
+// Modes of the delegate subcommand.
+const (
+	delegateCreate = "create"
+	delegateVerify = "verify"
+	delegateRemove = "remove"
+)
+
+// delegation is the CNAME a domain's challenge name needs.
+type delegation struct {
+	domain string
+	name   string
+	target string
+}
+
+// delegations returns the delegation for every domain, to `<domain>.<zone>`
+// when zone is set and according to the challengeRelocation rules otherwise.
+func delegations(rules []relocationRule, zone string, domains []string) ([]delegation, error) {
+	zone = strings.ToLower(strings.Trim(zone, "."))
+
+	var result []delegation
+	var unmatched []string
+	for _, domain := range domains {
+		bare := strings.ToLower(strings.TrimPrefix(strings.Trim(domain, "."), "*."))
+		name := challengePrefix + bare
+		if zone != "" {
+			result = append(result, delegation{domain: domain, name: name, target: bare + "." + zone})
+			continue
+		}
+		target, _, ok := relocate(rules, name)
+		if !ok {
+			unmatched = append(unmatched, domain)
+			continue
+		}
+		result = append(result, delegation{domain: domain, name: name, target: target})
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no challengeRelocation rule matches %s, pass -zone or add a rule", strings.Join(unmatched, ", "))
+	}
+	return result, nil
+}
+
+// runDelegate creates, verifies or removes the `_acme-challenge` CNAMEs that
+// delegate the given domains' challenge names into the ACME zone.
+func runDelegate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("delegate", flag.ContinueOnError)
+	configPath := flags.String("config", "", "Solver config file (YAML or JSON) used to connect to Infoblox")
+	zone := flags.String("zone", "", "Zone to delegate into; defaults to the config's challengeRelocation rules")
+	namespace := flags.String("namespace", "cert-manager", "Namespace of the credential Secrets referenced by the config")
+	kubeconfig := flags.String("kubeconfig", "", "Kubeconfig used to read credential Secrets; defaults to the usual loading rules")
+	verify := flags.Bool("verify", false, "Only check that the CNAMEs exist and point at the right target")
+	remove := flags.Bool("remove", false, "Remove the CNAMEs instead of creating them")
+	dryRun := flags.Bool("dry-run", false, "Print what would change without changing anything")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: delegate -config <file> [-zone <zone>] [-verify|-remove] [-dry-run] <domain>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("a config file and at least one domain are required")
+	}
+	mode, err := delegateMode(*verify, *remove)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+	plan, err := delegations(cfg.ChallengeRelocation, *zone, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	solver := &customDNSProviderSolver{}
+	if cfg.UsernameSecretRef.Key != "" || cfg.PasswordSecretRef.Key != "" {
+		solver.client, err = kubeClient(*kubeconfig)
+		if err != nil {
+			return err
+		}
+	}
+	defer solver.connectors.logoutAll()
+
+	ib, err := solver.getIbClient(&cfg, *namespace, false)
+	if err != nil {
+		return err
+	}
+	view, err := solver.resolveView(ib, &cfg)
+	if err != nil {
+		return err
+	}
+
+	return applyDelegations(ib, view, plan, mode, *dryRun, out)
+}
+
+// delegateMode maps the -verify and -remove flags to a mode.
+func delegateMode(verify, remove bool) (string, error) {
+	switch {
+	case verify && remove:
+		return "", fmt.Errorf("-verify and -remove are mutually exclusive")
+	case verify:
+		return delegateVerify, nil
+	case remove:
+		return delegateRemove, nil
+	default:
+		return delegateCreate, nil
+	}
+}
+
+// kubeClient builds a Kubernetes client from kubeconfig, or from the default
+// loading rules when it is empty.
+func kubeClient(kubeconfig string) (kubernetes.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("CMI: Error loading kubeconfig: %w", err)
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// applyDelegations brings every delegation to the state mode asks for and
+// prints one line per domain. Existing records are left alone unless they
+// match exactly, so the command is safe to re-run. Problems with individual
+// domains are collected and returned together.
+func applyDelegations(ib ibclient.IBConnector, view string, plan []delegation, mode string, dryRun bool, out io.Writer) error {
+	prefix := ""
+	if dryRun {
+		prefix = "(dry run) "
+	}
+
+	var errs []error
+	for _, d := range plan {
+		existing, err := getCNAMEs(ib, d.name, view)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.domain, err))
+			continue
+		}
+		current := findCNAME(existing, d.target)
+
+		switch {
+		case mode == delegateRemove && current == nil:
+			fmt.Fprintf(out, "absent   %s -> %s\n", d.name, d.target)
+		case mode == delegateRemove:
+			fmt.Fprintf(out, "%sremove   %s -> %s\n", prefix, d.name, d.target)
+			if !dryRun {
+				if _, err := ib.DeleteObject(current.Ref); err != nil {
+					errs = append(errs, fmt.Errorf("%s: CMI: Error removing CNAME %s: %w", d.domain, d.name, err))
+				}
+			}
+		case current != nil:
+			fmt.Fprintf(out, "ok       %s -> %s\n", d.name, d.target)
+		case len(existing) > 0:
+			other := strings.TrimSuffix(ptr.Deref(existing[0].Canonical, ""), ".")
+			fmt.Fprintf(out, "conflict %s -> %s, want %s\n", d.name, other, d.target)
+			errs = append(errs, fmt.Errorf("%s: %s already points to %s", d.domain, d.name, other))
+		case mode == delegateVerify:
+			fmt.Fprintf(out, "missing  %s -> %s\n", d.name, d.target)
+			errs = append(errs, fmt.Errorf("%s: %s is missing", d.domain, d.name))
+		default:
+			fmt.Fprintf(out, "%screate   %s -> %s\n", prefix, d.name, d.target)
+			if !dryRun {
+				record := ibclient.NewRecordCNAME(view, d.target, d.name, false, 0, delegationComment, nil, "")
+				if _, err := ib.CreateObject(record); err != nil {
+					errs = append(errs, fmt.Errorf("%s: CMI: Error creating CNAME %s: %w", d.domain, d.name, err))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// findCNAME returns the record among records pointing at target, if any.
+func findCNAME(records []ibclient.RecordCNAME, target string) *ibclient.RecordCNAME {
+	for i := range records {
+		if strings.EqualFold(strings.TrimSuffix(ptr.Deref(records[i].Canonical, ""), "."), target) {
+			return &records[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDelegations verifies targets come from -zone when given and from the
+// challengeRelocation rules otherwise
+func TestDelegations(t *testing.T) {
+	plan, err := delegations(testRelocationRules, "", []string{"*.App.example.com", "db.internal.example.com."})
+	require.NoError(t, err)
+	assert.Equal(t, []delegation{
+		{domain: "*.App.example.com", name: "_acme-challenge.app.example.com", target: "app.example.com.acme.example.net"},
+		{domain: "db.internal.example.com.", name: "_acme-challenge.db.internal.example.com", target: "db.internal.example.com.acme-internal.example.net"},
+	}, plan)
+
+	plan, err = delegations(nil, "acme.example.org.", []string{"example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, "example.org.acme.example.org", plan[0].target)
+
+	_, err = delegations(testRelocationRules, "", []string{"example.org"})
+	assert.ErrorContains(t, err, "example.org")
+}
+
+// TestApplyDelegations verifies create, verify and remove are idempotent,
+// dry runs change nothing and conflicting CNAMEs are left alone
+func TestApplyDelegations(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ib, cfg := fakeWAPIConnector(t, f, solver)
+	plan := []delegation{
+		{domain: "example.com", name: "_acme-challenge.example.com", target: "example.com.acme.example.net"},
+		{domain: "app.example.com", name: "_acme-challenge.app.example.com", target: "app.example.com.acme.example.net"},
+	}
+	cnames := func() int { return len(f.find("record:cname", nil)) }
+	run := func(mode string, dryRun bool) (string, error) {
+		var out bytes.Buffer
+		err := applyDelegations(ib, cfg.View, plan, mode, dryRun, &out)
+		return out.String(), err
+	}
+
+	out, err := run(delegateCreate, true)
+	require.NoError(t, err)
+	assert.Contains(t, out, "(dry run) create   _acme-challenge.example.com -> example.com.acme.example.net")
+	assert.Zero(t, cnames())
+
+	out, err = run(delegateVerify, false)
+	assert.Error(t, err)
+	assert.Contains(t, out, "missing  _acme-challenge.app.example.com")
+
+	_, err = run(delegateCreate, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, cnames())
+	assert.Equal(t, delegationComment, f.find("record:cname", map[string]string{"name": "_acme-challenge.example.com"})[0]["comment"])
+
+	out, err = run(delegateCreate, false)
+	require.NoError(t, err)
+	assert.Contains(t, out, "ok       _acme-challenge.example.com")
+	assert.Equal(t, 2, cnames())
+
+	_, err = run(delegateVerify, false)
+	require.NoError(t, err)
+
+	_, err = run(delegateRemove, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, cnames())
+
+	_, err = run(delegateRemove, false)
+	require.NoError(t, err)
+	assert.Zero(t, cnames())
+
+	out, err = run(delegateRemove, false)
+	require.NoError(t, err)
+	assert.Contains(t, out, "absent   _acme-challenge.example.com")
+}
+
+// TestApplyDelegations_Conflict verifies a CNAME pointing elsewhere is
+// reported and neither replaced nor removed
+func TestApplyDelegations_Conflict(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ib, cfg := fakeWAPIConnector(t, f, solver)
+	addCNAME(f, "_acme-challenge.example.com", "elsewhere.example.net")
+	plan := []delegation{{domain: "example.com", name: "_acme-challenge.example.com", target: "example.com.acme.example.net"}}
+
+	var out bytes.Buffer
+	err := applyDelegations(ib, cfg.View, plan, delegateCreate, false, &out)
+	require.Error(t, err)
+	assert.Contains(t, out.String(), "conflict _acme-challenge.example.com -> elsewhere.example.net")
+
+	require.NoError(t, applyDelegations(ib, cfg.View, plan, delegateRemove, false, &out))
+	assert.Len(t, f.find("record:cname", nil), 1)
+}
+
+// TestDelegateMode verifies -verify and -remove cannot be combined
+func TestDelegateMode(t *testing.T) {
+	mode, err := delegateMode(false, false)
+	require.NoError(t, err)
+	assert.Equal(t, delegateCreate, mode)
+
+	_, err = delegateMode(true, true)
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// eventComponent is the source reported on Kubernetes Events.
+const eventComponent = "cert-manager-webhook-infoblox-wapi"
+
+// Reasons of the Events emitted by the webhook.
+const (
+	// reasonDeleteRefused is emitted when a TXT record no longer matches the
+	// challenge it is being deleted for.
+	reasonDeleteRefused = "DeleteRefused"
+	// reasonScavengingDisabled is emitted when dynamic TXT records are created
+	// in a zone without DNS scavenging.
+	reasonScavengingDisabled = "ScavengingDisabled"
+	// reasonZonePolicyDenied is emitted when the zone policy denies a
+	// challenge.
+	reasonZonePolicyDenied = "ZonePolicyDenied"
+)
+
+// eventEmitter records Events on the webhook's own Pod. ChallengeRequests do
+// not identify the Challenge resource, so the Pod is the closest object an
+// operator can look at. A nil eventEmitter only logs.
+type eventEmitter struct {
+	recorder record.EventRecorder
+	target   *corev1.ObjectReference
+	shutdown func()
+}
+
+// newEventEmitterFromEnv returns an eventEmitter targeting the Pod named by
+// POD_NAME and POD_NAMESPACE, or nil when those are not set.
+func newEventEmitterFromEnv(client kubernetes.Interface) *eventEmitter {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if name == "" || namespace == "" {
+		klog.InfoS("CMI: POD_NAME or POD_NAMESPACE not set, Kubernetes Events are disabled")
+		return nil
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(namespace)})
+
+	return &eventEmitter{
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent}),
+		target: &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       name,
+			Namespace:  namespace,
+		},
+		shutdown: broadcaster.Shutdown,
+	}
+}
+
+// warning records a Warning Event.
+func (e *eventEmitter) warning(reason, message string) {
+	if e == nil {
+		return
+	}
+	e.recorder.Event(e.target, corev1.EventTypeWarning, reason, message)
+}
+
+// stop flushes and stops the event broadcaster.
+func (e *eventEmitter) stop() {
+	if e == nil || e.shutdown == nil {
+		return
+	}
+	e.shutdown()
+}
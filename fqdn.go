@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// maxNameLength is the longest presentation-format domain name without
+	// the trailing dot, in its ASCII form.
+	maxNameLength = 253
+	// maxLabelLength is the longest label, in its ASCII form.
+	maxLabelLength = 63
+)
+
+// idnaProfile maps names the way lookups do, which lowercases them, but
+// allows underscores as in `_acme-challenge`.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// normalizeFQDN returns the canonical form of fqdn used with WAPI: lowercase,
+// without the trailing dot, and with internationalized labels in Unicode,
+// which is how WAPI stores and returns record names. Punycode and Unicode
+// input therefore end up the same. Names that are empty, have empty labels,
+// labels or names that are too long, or characters outside letters, digits,
+// hyphens and underscores are rejected.
+func normalizeFQDN(fqdn string) (string, error) {
+	name := strings.TrimSuffix(fqdn, ".")
+	if name == "" {
+		return "", fmt.Errorf("CMI: Invalid domain name %q: empty", fqdn)
+	}
+
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("CMI: Invalid domain name %q: %w", fqdn, err)
+	}
+	if len(ascii) > maxNameLength {
+		return "", fmt.Errorf("CMI: Invalid domain name %q: longer than %d characters", fqdn, maxNameLength)
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if err := validateLabel(label); err != nil {
+			return "", fmt.Errorf("CMI: Invalid domain name %q: %w", fqdn, err)
+		}
+	}
+
+	unicode, err := idnaProfile.ToUnicode(ascii)
+	if err != nil {
+		return "", fmt.Errorf("CMI: Invalid domain name %q: %w", fqdn, err)
+	}
+	return unicode, nil
+}
+
+// validateLabel checks an ASCII label for length and characters.
+func validateLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+	}
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return fmt.Errorf("label %q starts or ends with a hyphen", label)
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return fmt.Errorf("label %q contains %q", label, r)
+		}
+	}
+	return nil
+}
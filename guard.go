@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+// maxGuardedDeletes bounds how many matching duplicates a guarded delete may
+// remove before reaching the ref it was asked to delete.
+const maxGuardedDeletes = 16
+
+// identityReturnFields are the fields checked before a delete.
+var identityReturnFields = []string{"name", "text", "view"}
+
+// checkBeforeDelete fetches the TXT record at ref and confirms it still
+// belongs to the challenge. gone is true when the ref no longer exists.
+func (c *customDNSProviderSolver) checkBeforeDelete(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) (gone bool, err error) {
+	mismatches, err := identityMismatches(ib, cfg, ref, name, text)
+	var notFoundErr *ibclient.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		klog.InfoS("CMI: TXT record no longer exists, nothing to delete", "ref", ref)
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("CMI: Error reading TXT record %s before deleting it: %w", ref, err)
+	}
+
+	if len(mismatches) > 0 {
+		return false, c.refuseDelete(ref, name, mismatches)
+	}
+	return false, nil
+}
+
+// identityMismatches reads the record at ref, a record:txt or a
+// sharedrecord:txt depending on cfg, and describes how it differs from the
+// challenge's name and text and the configured view or shared record group.
+func identityMismatches(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) ([]string, error) {
+	if cfg.SharedRecordGroup != "" {
+		return sharedRecordMismatches(ib, cfg, ref, name, text, false)
+	}
+	current, err := readTXTRecord(ib, ref, identityReturnFields)
+	if err != nil {
+		return nil, err
+	}
+	return txtIdentityMismatches(current, name, text, cfg.View), nil
+}
+
+// guardSearch returns the object type and search fields a guarded delete
+// uses to find the challenge's record.
+func guardSearch(cfg *customDNSProviderConfig, name, text string) (string, map[string]string, error) {
+	if cfg.SharedRecordGroup != "" {
+		fields, err := sharedSearchFields(cfg, name, text)
+		return "sharedrecord:txt", fields, err
+	}
+	return "record:txt", txtSearchFields(name, text, cfg.View), nil
+}
+
+// refuseDelete reports a TXT record that no longer matches its challenge, in
+// the log, as a Warning Event, and as the returned error.
+func (c *customDNSProviderSolver) refuseDelete(ref, name string, mismatches []string) error {
+	msg := fmt.Sprintf("Refusing to delete TXT record %s for %s, it no longer matches the challenge: %s", ref, name, strings.Join(mismatches, ", "))
+	klog.InfoS("CMI: "+msg, "ref", ref)
+	c.events.warning(reasonDeleteRefused, msg)
+	return fmt.Errorf("CMI: %s", msg)
+}
+
+// deleteGuarded deletes the TXT record at ref with a multi-object request
+// that searches for name, text and view or shared record group and deletes the match in the same
+// transaction, so a record edited after checkBeforeDelete is never deleted.
+// WAPI deletes the first match, which may be a duplicate of ref; those are
+// deleted too until ref is. handled is false when the Grid does not support
+// multi-object requests and the caller should delete by ref instead.
+func (c *customDNSProviderSolver) deleteGuarded(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) (handled bool, err error) {
+	key := gridKey(cfg)
+	if !c.batchSupport.supported(key) {
+		return false, nil
+	}
+
+	object, fields, err := guardSearch(cfg, name, text)
+	if err != nil {
+		return true, err
+	}
+
+	for i := 0; i < maxGuardedDeletes; i++ {
+		results, err := createMultiObject(ib, searchAndDeleteRequest(object, fields))
+		if err != nil {
+			if isBatchUnsupportedError(err) {
+				c.handleBatchError(key, "delete", name, err)
+				return false, nil
+			}
+			return true, c.guardedDeleteFailed(ib, cfg, ref, name, text, err)
+		}
+
+		deleted, err := batchResultRef(results, "ref")
+		if err != nil {
+			return true, fmt.Errorf("CMI: Unexpected guarded delete response for TXT record %s: %w", ref, err)
+		}
+		if deleted == ref {
+			return true, nil
+		}
+		klog.InfoS("CMI: Guarded delete removed a duplicate TXT record, continuing", "ref", ref, "deleted", deleted)
+	}
+
+	return true, fmt.Errorf("CMI: Gave up deleting TXT record %s after %d guarded deletes", ref, maxGuardedDeletes)
+}
+
+// guardedDeleteFailed works out why a guarded delete failed. The transaction
+// fails as a whole when nothing matched, which happens when the record was
+// edited or deleted since it was checked.
+func (c *customDNSProviderSolver) guardedDeleteFailed(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string, cause error) error {
+	gone, err := c.checkBeforeDelete(ib, cfg, ref, name, text)
+	if gone {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("CMI: Guarded delete of TXT record %s failed, nothing was deleted: %w", ref, cause)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// fakeWAPIConnector returns a connector and config for the fake WAPI.
+func fakeWAPIConnector(t *testing.T, f *fakeWAPI, solver *customDNSProviderSolver) (ibclient.IBConnector, *customDNSProviderConfig) {
+	t.Helper()
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "default", "version": "2.10"})
+	cfg, err := loadConfig(ch.Config, nil)
+	require.NoError(t, err)
+	ib, err := solver.getIbClient(&cfg, ch.ResourceNamespace, false)
+	require.NoError(t, err)
+	return ib, &cfg
+}
+
+// TestDeleteTXTRecord_RefusesChangedRecord verifies a ref whose record no
+// longer matches the challenge is not deleted and a Warning Event is emitted
+func TestDeleteTXTRecord_RefusesChangedRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+		want   string
+	}{
+		{
+			name:   "text edited",
+			record: map[string]interface{}{"name": "_acme-challenge.example.com", "text": "edited", "view": "default"},
+			want:   "text is edited, want key-1",
+		},
+		{
+			name:   "moved to another view",
+			record: map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-1", "view": "internal"},
+			want:   "view is internal, want default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			solver := newFakeWAPISolver()
+			recorder := record.NewFakeRecorder(10)
+			solver.events = &eventEmitter{recorder: recorder, target: &corev1.ObjectReference{Kind: "Pod", Name: "webhook", Namespace: "cert-manager"}}
+			ib, cfg := fakeWAPIConnector(t, f, solver)
+			ref := f.add("record:txt", tt.record)
+
+			err := solver.DeleteTXTRecord(ib, cfg, ref, "_acme-challenge.example.com", "key-1")
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "Refusing to delete")
+			assert.Contains(t, err.Error(), tt.want)
+			assert.Len(t, f.find("record:txt", nil), 1)
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, "Warning DeleteRefused")
+		})
+	}
+}
+
+// TestDeleteTXTRecord_StaleRef verifies a ref that no longer exists is treated
+// as already deleted
+func TestDeleteTXTRecord_StaleRef(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ib, cfg := fakeWAPIConnector(t, f, solver)
+
+	err := solver.DeleteTXTRecord(ib, cfg, "record:txt/ZG5zLmJpbmRfdHh0$99:_acme-challenge.example.com", "_acme-challenge.example.com", "key-1")
+
+	require.NoError(t, err)
+	assert.Zero(t, f.count("DELETE record:txt"))
+	assert.Zero(t, f.count("POST request"))
+}
+
+// TestDeleteTXTRecord_Guarded verifies the delete runs in a multi-object
+// transaction where the Grid supports one, and by ref otherwise
+func TestDeleteTXTRecord_Guarded(t *testing.T) {
+	for _, noBatch := range []bool{false, true} {
+		f := newFakeWAPI(t)
+		f.noBatch = noBatch
+		solver := newFakeWAPISolver()
+		ib, cfg := fakeWAPIConnector(t, f, solver)
+		ref := f.add("record:txt", map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-1", "view": "default"})
+
+		require.NoError(t, solver.DeleteTXTRecord(ib, cfg, ref, "_acme-challenge.example.com", "key-1"))
+
+		assert.Empty(t, f.find("record:txt", nil))
+		if noBatch {
+			assert.Equal(t, 1, f.count("DELETE record:txt"))
+		} else {
+			assert.Zero(t, f.count("DELETE record:txt"))
+			assert.Equal(t, 1, f.count("POST request"))
+		}
+	}
+}
+
+// TestEventEmitter_Disabled verifies a missing Pod identity disables Events
+// without breaking callers
+func TestEventEmitter_Disabled(t *testing.T) {
+	t.Setenv("POD_NAME", "")
+	t.Setenv("POD_NAMESPACE", "")
+
+	events := newEventEmitterFromEnv(nil)
+
+	assert.Nil(t, events)
+	events.warning(reasonDeleteRefused, "ignored")
+	events.stop()
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// LeaseLockNamespaceEnv enables cross-replica locking with Kubernetes Leases
+// created in the named namespace.
+const LeaseLockNamespaceEnv = "LEASE_LOCK_NAMESPACE"
+
+const (
+	// leaseDuration is how long a Lease is honoured without being renewed,
+	// so a crashed replica cannot block a challenge name forever.
+	leaseDuration = 60 * time.Second
+	// leaseRenewInterval is how often a held Lease is renewed. Present and
+	// CleanUp can hold it through several slow WAPI calls, each of which may
+	// take up to the client timeout, so it is renewed until released.
+	leaseRenewInterval = leaseDuration / 3
+	// leaseRetryInterval is how often a held Lease is polled.
+	leaseRetryInterval = 500 * time.Millisecond
+	// leaseAcquireTimeout bounds how long Present/CleanUp wait for a Lease.
+	leaseAcquireTimeout = 2 * time.Minute
+)
+
+// keyedMutex serializes callers per key. Entries are reference counted and
+// dropped once nobody holds or waits for them.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock blocks until key is free and returns the matching unlock function.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedMutexEntry)
+	}
+	entry, ok := k.locks[key]
+	if !ok {
+		entry = &keyedMutexEntry{}
+		k.locks[key] = entry
+	}
+	entry.refs++
+	k.mu.Unlock()
+
+	entry.mu.Lock()
+
+	return func() {
+		entry.mu.Unlock()
+		k.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// challengeLockKey identifies a challenge record name within a view. DNS
+// names are case insensitive, so the key is too.
+func challengeLockKey(name, view string) string {
+	return strings.ToLower(view + "/" + name)
+}
+
+// lockChallenge serializes Present and CleanUp for the same name and view,
+// which are check-then-act sequences against WAPI. The in-process lock covers
+// concurrent challenges in this replica; the optional Lease covers replicas.
+func (c *customDNSProviderSolver) lockChallenge(name, view string) (func(), error) {
+	key := challengeLockKey(name, view)
+	unlock := c.locks.lock(key)
+
+	if c.leaseLock == nil {
+		return unlock, nil
+	}
+
+	release, err := c.leaseLock.acquire(key)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return func() {
+		release()
+		unlock()
+	}, nil
+}
+
+// leaseLocker implements a cross-replica lock with coordination.k8s.io Leases.
+type leaseLocker struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+	// now is replaceable in tests.
+	now func() time.Time
+}
+
+// newLeaseLockerFromEnv returns a leaseLocker when LEASE_LOCK_NAMESPACE is
+// set, and nil otherwise. The holder identity is the pod name when exposed
+// through POD_NAME, falling back to the hostname.
+func newLeaseLockerFromEnv(client kubernetes.Interface) *leaseLocker {
+	namespace := os.Getenv(LeaseLockNamespaceEnv)
+	if namespace == "" {
+		return nil
+	}
+
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	klog.InfoS("CMI: Using Lease locks across replicas", "namespace", namespace, "identity", identity)
+
+	return &leaseLocker{client: client, namespace: namespace, identity: identity, now: time.Now}
+}
+
+// leaseName maps a lock key to a valid, stable Lease name.
+func leaseName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "infoblox-wapi-" + hex.EncodeToString(sum[:])[:32]
+}
+
+// acquire blocks until the Lease for key is held by this replica and returns
+// the function that releases it. The Lease is renewed until then.
+func (l *leaseLocker) acquire(key string) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseAcquireTimeout)
+	defer cancel()
+
+	name := leaseName(key)
+	for {
+		held, err := l.tryAcquire(ctx, name, key)
+		if err != nil {
+			return nil, fmt.Errorf("CMI: Error acquiring lock Lease %s/%s: %w", l.namespace, name, err)
+		}
+		if held {
+			klog.InfoS("CMI: Acquired lock Lease", "lease", name, "key", key)
+			stop, stopped := make(chan struct{}), make(chan struct{})
+			go l.keepRenewed(name, stop, stopped)
+			return func() {
+				close(stop)
+				<-stopped
+				l.release(name)
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("CMI: Timed out waiting for lock Lease %s/%s held for %s", l.namespace, name, key)
+		case <-time.After(leaseRetryInterval):
+		}
+	}
+}
+
+// tryAcquire creates the Lease, or takes it over once it expired. Conflicts
+// with another replica doing the same are reported as not held.
+func (l *leaseLocker) tryAcquire(ctx context.Context, name, key string) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(l.identity),
+		LeaseDurationSeconds: ptr.To(int32(leaseDuration / time.Second)),
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   l.namespace,
+			Annotations: map[string]string{"infoblox-wapi.cert-manager.io/lock-key": key},
+		},
+		Spec: spec,
+	}
+	_, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return false, err
+	}
+
+	existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Released in the meantime, retry the create on the next round.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !l.expired(existing) {
+		return false, nil
+	}
+
+	klog.InfoS("CMI: Taking over expired lock Lease", "lease", name, "previousHolder", ptr.Deref(existing.Spec.HolderIdentity, ""))
+	existing.Spec = spec
+	_, err = leases.Update(ctx, existing, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// keepRenewed renews the Lease every leaseRenewInterval until stop is closed
+// or the Lease is lost, then closes stopped.
+func (l *leaseLocker) keepRenewed(name string, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !l.renew(name) {
+				return
+			}
+		}
+	}
+}
+
+// renew moves the Lease's renew time forward and reports whether this
+// replica still holds it. Errors are logged and retried on the next round.
+func (l *leaseLocker) renew(name string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseRenewInterval)
+	defer cancel()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		klog.InfoS("CMI: Lock Lease was deleted while held", "lease", name)
+		return false
+	}
+	if err != nil {
+		klog.InfoS("CMI: Error reading lock Lease for renewal", "lease", name, "error", err.Error())
+		return true
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.identity {
+		klog.InfoS("CMI: Lock Lease was taken over while held", "lease", name, "holder", ptr.Deref(lease.Spec.HolderIdentity, ""))
+		return false
+	}
+
+	lease.Spec.RenewTime = ptr.To(metav1.NewMicroTime(l.now()))
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		klog.InfoS("CMI: Error renewing lock Lease", "lease", name, "error", err.Error())
+	}
+	return true
+}
+
+// expired reports whether lease is past its renew time plus duration.
+func (l *leaseLocker) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return l.now().After(expiry)
+}
+
+// release deletes the Lease if this replica still holds it.
+func (l *leaseLocker) release(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		klog.InfoS("CMI: Error reading lock Lease for release", "lease", name, "error", err.Error())
+		return
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.identity {
+		klog.InfoS("CMI: Lock Lease was taken over, not releasing", "lease", name, "holder", ptr.Deref(lease.Spec.HolderIdentity, ""))
+		return
+	}
+
+	err = leases.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.InfoS("CMI: Error releasing lock Lease", "lease", name, "error", err.Error())
+	}
+}
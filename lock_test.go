@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestPresent_ConcurrentSameName verifies concurrent Present calls for the same
+// name and value create exactly one record, even though the fake WAPI accepts
+// duplicates
+func TestPresent_ConcurrentSameName(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Apex and wildcard challenges share the name but not the value
+			key := fmt.Sprintf("key-%d", i%2)
+			errs <- solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", key, extra))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Len(t, f.find("record:txt", map[string]string{"text": "key-0"}), 1)
+	assert.Len(t, f.find("record:txt", map[string]string{"text": "key-1"}), 1)
+	assert.Empty(t, solver.locks.locks, "lock entries should be released")
+}
+
+// TestPresentCleanUp_Concurrent verifies interleaved Present and CleanUp calls
+// for the same name leave no records behind and never fail
+func TestPresentCleanUp_Concurrent(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ch := fakeChallenge(t, f, "_acme-challenge.example.com.", fmt.Sprintf("key-%d", i), extra)
+			errs <- solver.Present(ch)
+			errs <- solver.CleanUp(ch)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Empty(t, f.find("record:txt", nil))
+}
+
+// TestChallengeLockKey verifies keys are per view and case insensitive
+func TestChallengeLockKey(t *testing.T) {
+	assert.Equal(t, challengeLockKey("_acme-challenge.Example.com", "default"), challengeLockKey("_acme-challenge.example.com", "default"))
+	assert.NotEqual(t, challengeLockKey("_acme-challenge.example.com", "internal"), challengeLockKey("_acme-challenge.example.com", "external"))
+}
+
+// TestLeaseLocker_Exclusive verifies a second replica waits until the first
+// releases the Lease
+func TestLeaseLocker_Exclusive(t *testing.T) {
+	client := fake.NewClientset()
+	first := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-a", now: time.Now}
+	second := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-b", now: time.Now}
+
+	release, err := first.acquire("default/_acme-challenge.example.com")
+	require.NoError(t, err)
+
+	acquired := make(chan func(), 1)
+	go func() {
+		releaseSecond, err := second.acquire("default/_acme-challenge.example.com")
+		if err == nil {
+			acquired <- releaseSecond
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second replica acquired a held Lease")
+	case <-time.After(2 * leaseRetryInterval):
+	}
+
+	release()
+
+	select {
+	case releaseSecond := <-acquired:
+		releaseSecond()
+	case <-time.After(10 * leaseRetryInterval):
+		t.Fatal("second replica did not acquire the released Lease")
+	}
+}
+
+// TestLeaseLocker_TakesOverExpired verifies a Lease left behind by a crashed
+// replica is taken over once it expires
+func TestLeaseLocker_TakesOverExpired(t *testing.T) {
+	client := fake.NewClientset()
+	crashed := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-a", now: func() time.Time {
+		return time.Now().Add(-2 * leaseDuration)
+	}}
+	live := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-b", now: time.Now}
+
+	_, err := crashed.acquire("default/_acme-challenge.example.com")
+	require.NoError(t, err)
+
+	release, err := live.acquire("default/_acme-challenge.example.com")
+	require.NoError(t, err)
+	release()
+}
+
+// TestLeaseLocker_Renew verifies a held Lease is renewed, and that renewal
+// stops once another replica took it over
+func TestLeaseLocker_Renew(t *testing.T) {
+	client := fake.NewClientset()
+	start := time.Now()
+	clock := start
+	holder := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-a", now: func() time.Time { return clock }}
+	other := &leaseLocker{client: client, namespace: "cert-manager", identity: "replica-b", now: func() time.Time { return clock }}
+
+	key := "default/_acme-challenge.example.com"
+	name := leaseName(key)
+	held, err := holder.tryAcquire(context.Background(), name, key)
+	require.NoError(t, err)
+	require.True(t, held)
+
+	// Without renewal the Lease would have expired by now.
+	clock = start.Add(leaseDuration - time.Second)
+	require.True(t, holder.renew(name))
+	clock = start.Add(leaseDuration + time.Second)
+	lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, holder.expired(lease))
+
+	held, err = other.tryAcquire(context.Background(), name, key)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Once taken over, renewal stops.
+	clock = start.Add(3 * leaseDuration)
+	held, err = other.tryAcquire(context.Background(), name, key)
+	require.NoError(t, err)
+	require.True(t, held)
+	assert.False(t, holder.renew(name))
+}
@@ -13,11 +13,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -37,6 +39,11 @@ const SecretPath = "/etc/secrets/creds.json" //nolint:gosec // G101: This is a f
 var GroupName = os.Getenv("GROUP_NAME")
 
 func main() {
+	// CLI helpers run instead of the webhook server when named first.
+	if runSubcommand(os.Args[1:]) {
+		return
+	}
+
 	if GroupName == "" {
 		panic("GROUP_NAME must be specified")
 	}
@@ -48,7 +55,8 @@ func main() {
 	// webhook, where the Name() method will be used to disambiguate between
 	// the different implementations.
 
-	cmd.RunWebhookServer(GroupName, &customDNSProviderSolver{})
+	solver := &customDNSProviderSolver{}
+	cmd.RunWebhookServer(GroupName, solver, &bloxoneSolver{common: solver})
 }
 
 // Validate the customDNSProviderSolver satisfies the interface that cert manager expects.
@@ -66,6 +74,41 @@ type customDNSProviderSolver struct {
 	// 4. ensure your webhook's service account has the required RBAC role
 	//    assigned to it for interacting with the Kubernetes APIs you need.
 	client kubernetes.Interface
+
+	// defaultViews caches the default DNS view of each Grid, used when an
+	// issuer does not configure a view.
+	defaultViews defaultViewCache
+
+	// wapiVersions caches the WAPI version negotiated with each Grid when an
+	// issuer sets version to "auto".
+	wapiVersions wapiVersionCache
+
+	// connectors caches one connector per Grid connection and credential so
+	// the WAPI session cookie is reused across challenges.
+	connectors connectorCache
+
+	// batchSupport remembers Grids that do not support multi-object requests.
+	batchSupport batchSupportCache
+
+	// locks serializes Present and CleanUp per record name and view.
+	locks keyedMutex
+
+	// leaseLock extends that serialization across replicas when
+	// LEASE_LOCK_NAMESPACE is set.
+	leaseLock *leaseLocker
+
+	// events records Kubernetes Events on the webhook Pod, e.g. when a delete
+	// is refused.
+	events *eventEmitter
+
+	// relocationZones caches challengeRelocation zones known to exist.
+	relocationZones relocationZoneCache
+	// scavengingReports caches zones whose scavenging settings were reported.
+	scavengingReports scavengingReportCache
+
+	// connections reads the InfobloxConnections issuers refer to with
+	// connectionRef.
+	connections *connectionClient
 }
 
 // customDNSProviderConfig is a structure that is used to decode into when
@@ -88,18 +131,37 @@ type customDNSProviderConfig struct {
 	// These fields will be set by users in the
 	// `issuer.spec.acme.dns01.providers.webhook.config` field.
 
-	Host                string                   `json:"host"`
-	Port                string                   `json:"port"`
-	Version             string                   `json:"version"`
-	UsernameSecretRef   cmmeta.SecretKeySelector `json:"usernameSecretRef"`
-	PasswordSecretRef   cmmeta.SecretKeySelector `json:"passwordSecretRef"`
-	View                string                   `json:"view"`
-	SslVerify           bool                     `json:"sslVerify"`
-	HTTPRequestTimeout  int                      `json:"httpRequestTimeout"`
-	HTTPPoolConnections int                      `json:"httpPoolConnections"`
-	GetUserFromVolume   bool                     `json:"getUserFromVolume"`
-	TTL                 uint32                   `json:"ttl"`
-	UseTTL              bool                     `json:"useTtl"`
+	Host                string            `json:"host"`
+	Port                string            `json:"port"`
+	Version             string            `json:"version"`
+	UsernameSecretRef   secretKeySelector `json:"usernameSecretRef"`
+	PasswordSecretRef   secretKeySelector `json:"passwordSecretRef"`
+	APIKeySecretRef     secretKeySelector `json:"apiKeySecretRef"`
+	View                string            `json:"view"`
+	SslVerify           bool              `json:"sslVerify"`
+	CABundle            string            `json:"caBundle"`
+	HTTPRequestTimeout  int               `json:"httpRequestTimeout"`
+	HTTPPoolConnections int               `json:"httpPoolConnections"`
+	GetUserFromVolume   bool              `json:"getUserFromVolume"`
+	TTL                 uint32            `json:"ttl"`
+	UseTTL              bool              `json:"useTtl"`
+	BatchRequests       bool              `json:"batchRequests"`
+	VerifyRecords       string            `json:"verifyRecords"`
+	ChallengeRelocation []relocationRule  `json:"challengeRelocation"`
+	SharedRecordGroup   string            `json:"sharedRecordGroup"`
+	SharedRecordZone    string            `json:"sharedRecordZone"`
+	DynamicRecords      bool              `json:"dynamicRecords"`
+	DDNSPrincipal       string            `json:"ddnsPrincipal"`
+	CommentTemplate     string            `json:"commentTemplate"`
+	Cloud               *cloudConfig      `json:"cloud"`
+	ConnectionRef       string            `json:"connectionRef"`
+	RFC2136             *rfc2136Config    `json:"rfc2136"`
+	Mirror              *mirrorConfig     `json:"mirror"`
+
+	// commentTemplate is CommentTemplate parsed by loadConfig, and comment
+	// the comment Present renders from it for the current challenge.
+	commentTemplate *template.Template
+	comment         string
 }
 
 type usernamePassword struct {
@@ -124,34 +186,77 @@ func (c *customDNSProviderSolver) Name() string {
 // solver has correctly configured the DNS provider.
 func (c *customDNSProviderSolver) Present(ch *whapi.ChallengeRequest) error {
 	klog.InfoS("CMI: Presenting DNS record", "DNS", ch.DNSName)
-	cfg, err := loadConfig(ch.Config)
+	cfg, err := loadConfig(ch.Config, c.connections)
 	if err != nil {
 		klog.InfoS("CMI: Error loading config", "error", err.Error())
 		return err
 	}
+	if err := c.authorizeChallenge(&cfg, ch, opPresent); err != nil {
+		return err
+	}
 
+	mirror := mirrorTarget(&cfg)
+	err = c.withRFC2136Fallback(&cfg, ch, false, c.presentWAPI(&cfg, ch))
+	return c.withMirror(&cfg, mirror, ch, opPresent, err, c.presentWAPI)
+}
+
+// presentWAPI presents the DNS record through WAPI on the Grid cfg connects to.
+func (c *customDNSProviderSolver) presentWAPI(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest) error {
 	// Initialize ibclient
-	ib, err := c.getIbClient(&cfg, ch.ResourceNamespace)
+	ib, err := c.getIbClient(cfg, ch.ResourceNamespace, ch.AllowAmbientCredentials)
 	if err != nil {
 		klog.InfoS("CMI: Error getting Infoblox client", "error", err.Error())
 		return err
 	}
 
+	cfg.View, err = c.resolveView(ib, cfg)
+	if err != nil {
+		klog.InfoS("CMI: Error resolving DNS view", "error", err.Error())
+		return err
+	}
+
 	// Find or create TXT record
-	recordName := c.DeDot(ch.ResolvedFQDN)
+	recordName, err := c.challengeRecordName(ib, cfg, ch, opPresent)
+	if err != nil {
+		klog.InfoS("CMI: Error determining record name", "error", err.Error())
+		return err
+	}
 	klog.InfoS("CMI: Record name", "name", recordName)
+	cfg.comment = renderComment(cfg, ch, recordName)
+
+	unlock, err := c.lockChallenge(recordName, cfg.View)
+	if err != nil {
+		klog.InfoS("CMI: Error locking record name", "name", recordName, "error", err.Error())
+		return err
+	}
+	defer unlock()
+
+	if recordRef, handled := c.presentBatched(ib, cfg, recordName, ch.Key); handled {
+		// An empty ref means the record already existed.
+		if recordRef != "" {
+			if err := c.checkCreatedRecord(ib, cfg, recordRef, recordName, ch.Key); err != nil {
+				return err
+			}
+		}
+		klog.InfoS("CMI: Done presenting for DNS record", "DNS", ch.DNSName, "ref", recordRef)
+		return nil
+	}
 
 	klog.InfoS("CMI: Getting current txt record.", "key", ch.Key)
-	recordRef, err := c.GetTXTRecord(ib, recordName, ch.Key, cfg.View)
-	klog.InfoS("CMI: Record ref after getting current txt record", "recordRef", recordRef)
+	recordRefs, err := c.GetTXTRecords(ib, cfg, recordName, ch.Key)
+	klog.InfoS("CMI: Record refs after getting current txt record", "recordRefs", recordRefs)
 
 	if err != nil {
 		klog.InfoS("CMI: Error getting TXT record", "name", recordName, "error", err.Error())
 		return err
 	}
 
-	// GetTXTRecord filters by both name AND text (ch.Key), so a non-empty
-	// recordRef means a TXT record with this exact name and value already
+	if len(recordRefs) > 1 {
+		klog.InfoS("CMI: WARNING: Found duplicate TXT records, CleanUp will remove all of them", "name", recordName, "count", len(recordRefs), "refs", recordRefs)
+	}
+
+	// GetTXTRecords filters by both name AND text (ch.Key), so any match
+	// means a TXT record with this exact name and value already
 	// exists. cert-manager calls Present repeatedly while a challenge is
 	// pending, so treat that as success and return immediately. Deleting and
 	// recreating an identical record is not only pointless, it briefly removes
@@ -160,15 +265,15 @@ func (c *customDNSProviderSolver) Present(ch *whapi.ChallengeRequest) error {
 	// publish different values at the SAME _acme-challenge.example.com name; the
 	// delete-before-recreate window can hide a sibling value from cert-manager's
 	// self-check or Let's Encrypt's validation, causing intermittent failures.
-	if recordRef != "" {
-		klog.InfoS("CMI: TXT record already exists with the correct value, nothing to do", "name", recordName, "ref", recordRef)
+	if len(recordRefs) > 0 {
+		klog.InfoS("CMI: TXT record already exists with the correct value, nothing to do", "name", recordName, "ref", recordRefs[0])
 		klog.InfoS("CMI: Done presenting for DNS record", "DNS", ch.DNSName)
 		return nil
 	}
 
 	// Create the TXT record
 	klog.InfoS("CMI: Creating TXT record", "name", recordName)
-	recordRef, err = c.CreateTXTRecord(ib, recordName, ch.Key, cfg.View, cfg.TTL, cfg.UseTTL)
+	recordRef, err := c.CreateTXTRecord(ib, cfg, recordName, ch.Key)
 	klog.InfoS("CMI: Record ref after creating txt record", "recordRef", recordRef)
 
 	if err != nil {
@@ -178,6 +283,11 @@ func (c *customDNSProviderSolver) Present(ch *whapi.ChallengeRequest) error {
 
 	klog.InfoS("CMI: Successfully created TXT record", "name", recordName, "ref", recordRef)
 
+	if err := c.checkCreatedRecord(ib, cfg, recordRef, recordName, ch.Key); err != nil {
+		klog.InfoS("CMI: Error verifying TXT record", "name", recordName, "error", err.Error())
+		return err
+	}
+
 	klog.InfoS("CMI: Done presenting for DNS record", "DNS", ch.DNSName)
 	return nil
 }
@@ -190,37 +300,76 @@ func (c *customDNSProviderSolver) Present(ch *whapi.ChallengeRequest) error {
 // concurrently.
 func (c *customDNSProviderSolver) CleanUp(ch *whapi.ChallengeRequest) error {
 	klog.InfoS("CMI: Cleaning up")
-	cfg, err := loadConfig(ch.Config)
+	cfg, err := loadConfig(ch.Config, c.connections)
 	if err != nil {
 		return err
 	}
+	if err := c.authorizeChallenge(&cfg, ch, opCleanUp); err != nil {
+		return err
+	}
 
+	mirror := mirrorTarget(&cfg)
+	err = c.withRFC2136Fallback(&cfg, ch, true, c.cleanUpWAPI(&cfg, ch))
+	return c.withMirror(&cfg, mirror, ch, opCleanUp, err, c.cleanUpWAPI)
+}
+
+// cleanUpWAPI cleans up the DNS record through WAPI on the Grid cfg connects to.
+func (c *customDNSProviderSolver) cleanUpWAPI(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest) error {
 	// Initialize ibclient
-	ib, err := c.getIbClient(&cfg, ch.ResourceNamespace)
+	ib, err := c.getIbClient(cfg, ch.ResourceNamespace, ch.AllowAmbientCredentials)
+	if err != nil {
+		return err
+	}
+
+	cfg.View, err = c.resolveView(ib, cfg)
 	if err != nil {
 		return err
 	}
 
 	// Find and delete TXT record
-	recordName := c.DeDot(ch.ResolvedFQDN)
+	recordName, err := c.challengeRecordName(ib, cfg, ch, opCleanUp)
+	if err != nil {
+		return err
+	}
 
-	recordRef, err := c.GetTXTRecord(ib, recordName, ch.Key, cfg.View)
+	unlock, err := c.lockChallenge(recordName, cfg.View)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	if recordRef == "" {
-		klog.InfoS("CMI: TXT record not found, skipping deletion", "name", recordName, "text", ch.Key)
-		return nil
+	batchedRef, batched := c.cleanUpBatched(ib, cfg, recordName, ch.Key)
+	if batched {
+		klog.InfoS("CMI: Deleted TXT record", "name", recordName, "ref", batchedRef)
 	}
 
-	err = c.DeleteTXTRecord(ib, recordRef)
+	// Earlier non-batched runs, races or manual retries can have left
+	// duplicates behind, so look for more even after a batched delete.
+	recordRefs, err := c.GetTXTRecords(ib, cfg, recordName, ch.Key)
 	if err != nil {
 		return err
 	}
-	klog.InfoS("CMI: Deleted TXT record", "name", recordName, "ref", recordRef)
 
-	return nil
+	if len(recordRefs) == 0 {
+		if !batched {
+			klog.InfoS("CMI: TXT record not found, skipping deletion", "name", recordName, "text", ch.Key)
+		}
+		return nil
+	}
+
+	// Delete every duplicate, carrying on past failures so one bad ref does
+	// not leave the others behind.
+	var errs []error
+	for _, recordRef := range recordRefs {
+		if err := c.DeleteTXTRecord(ib, cfg, recordRef, recordName, ch.Key); err != nil {
+			klog.InfoS("CMI: Error deleting TXT record", "name", recordName, "ref", recordRef, "error", err.Error())
+			errs = append(errs, fmt.Errorf("CMI: Error deleting TXT record %s: %w", recordRef, err))
+			continue
+		}
+		klog.InfoS("CMI: Deleted TXT record", "name", recordName, "ref", recordRef)
+	}
+
+	return errors.Join(errs...)
 }
 
 // Initialize will be called when the webhook first starts.
@@ -231,8 +380,9 @@ func (c *customDNSProviderSolver) CleanUp(ch *whapi.ChallengeRequest) error {
 // Secret resources containing credentials used to authenticate with DNS
 // provider accounts.
 // The stopCh can be used to handle early termination of the webhook, in cases
-// where a SIGTERM or similar signal is sent to the webhook process.
-func (c *customDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, _ <-chan struct{}) error {
+// where a SIGTERM or similar signal is sent to the webhook process. It is
+// used to log out of any open WAPI sessions on shutdown.
+func (c *customDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
 	klog.InfoS("CMI: Initializing k8s client")
 	cl, err := kubernetes.NewForConfig(kubeClientConfig)
 	if err != nil {
@@ -241,28 +391,90 @@ func (c *customDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, _ <-
 	}
 	klog.InfoS("CMI: Initialized k8s client")
 	c.client = cl
+	dyn, err := dynamic.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	c.connections = &connectionClient{client: dyn}
+	c.connections.watch(stopCh)
+	c.leaseLock = newLeaseLockerFromEnv(cl)
+	c.events = newEventEmitterFromEnv(cl)
+
+	go func() {
+		<-stopCh
+		c.connectors.logoutAll()
+		c.events.stop()
+	}()
+	go c.connections.run(stopCh)
+	go c.serveAdmission(stopCh)
 
 	return nil
 }
 
 // loadConfig is a small helper function that decodes JSON configuration into
-// the typed config struct.
-func loadConfig(cfgJSON *apiextensionsv1.JSON) (customDNSProviderConfig, error) {
+// the typed config struct. The config is decoded over the webhook defaults
+// and, with connectionRef set, the InfobloxConnection read through
+// connections. See decodeConfig.
+func loadConfig(cfgJSON *apiextensionsv1.JSON, connections *connectionClient) (customDNSProviderConfig, error) {
 	klog.InfoS("CMI: Loading config")
 
-	cfg := customDNSProviderConfig{}
 	// handle the 'base case' where no configuration has been provided
 	if cfgJSON == nil {
-		return cfg, nil
+		return customDNSProviderConfig{}, nil
 	}
-	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
-		return cfg, fmt.Errorf("CMI: Error decoding solver config: %w", err)
+	cfg, err := decodeConfig(cfgJSON, connections)
+	if err != nil {
+		return cfg, err
 	}
+	return cfg, finishConfig(&cfg)
+}
 
+// finishConfig applies the built-in defaults to a decoded config, validates
+// it and parses its comment template.
+func finishConfig(cfg *customDNSProviderConfig) error {
 	// Apply default values for fields that weren't set
-	applyDefaults(&cfg)
+	applyDefaults(cfg)
 
-	return cfg, nil
+	if err := validateConfig(cfg); err != nil {
+		return err
+	}
+	tmpl, err := parseCommentTemplate(cfg.CommentTemplate)
+	if err != nil {
+		return err
+	}
+	cfg.commentTemplate = tmpl
+
+	return nil
+}
+
+// validateConfig checks the options that need validating and normalizes
+// them.
+func validateConfig(cfg *customDNSProviderConfig) error {
+	if err := validateVerifyMode(cfg.VerifyRecords); err != nil {
+		return err
+	}
+	if err := validateRelocationRules(cfg.ChallengeRelocation); err != nil {
+		return err
+	}
+	cfg.SharedRecordZone = strings.ToLower(strings.Trim(cfg.SharedRecordZone, "."))
+	if err := validateDynamicRecords(cfg); err != nil {
+		return err
+	}
+	if err := validateCloud(cfg); err != nil {
+		return err
+	}
+	if err := validateRFC2136(cfg.RFC2136); err != nil {
+		return err
+	}
+	if err := validateMirror(cfg); err != nil {
+		return err
+	}
+	if cfg.CABundle != "" {
+		if _, err := wapiTLSConfig(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // applyDefaults sets default values for configuration fields that are zero/empty.
@@ -272,7 +484,7 @@ func applyDefaults(cfg *customDNSProviderConfig) {
 		cfg.Port = "443"
 	}
 	if cfg.Version == "" {
-		cfg.Version = "2.10"
+		cfg.Version = versionAuto
 	}
 	if cfg.HTTPRequestTimeout <= 0 {
 		cfg.HTTPRequestTimeout = 60
@@ -290,25 +502,49 @@ func applyDefaults(cfg *customDNSProviderConfig) {
 
 // Initialize and return infoblox client connector
 // Configuration can be set in the webhook `config` section.
-// Two secretRefs are needed to securely pass infoblox credentials
-func (c *customDNSProviderSolver) getIbClient(cfg *customDNSProviderConfig, namespace string) (ibclient.IBConnector, error) {
-	var username, password string
+// Two secretRefs are needed to securely pass infoblox credentials, unless
+// allowAmbient lets the webhook's ambient credentials be used instead.
+func (c *customDNSProviderSolver) getIbClient(cfg *customDNSProviderConfig, namespace string, allowAmbient bool) (ibclient.IBConnector, error) {
+	username, password, err := c.getCredentials(cfg, namespace, allowAmbient)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := c.negotiateVersion(cfg, username, password)
+	if err != nil {
+		klog.InfoS("CMI: Error determining WAPI version", "error", err.Error())
+		return nil, err
+	}
+	cfg.Version = version
+
+	// Reuse the connector, and its WAPI session, for this Grid and credential
+	ib, err := c.connectors.get(cfg, username, password)
+	if err != nil {
+		klog.InfoS("CMI: Error creating Infoblox client", "error", err.Error())
+		return nil, err
+	}
+
+	return ib, nil
+}
+
+// getCredentials returns the Infoblox username and password from the config's
+// secretRefs, the mounted secret file, or else the ambient credentials.
+func (c *customDNSProviderSolver) getCredentials(cfg *customDNSProviderConfig, namespace string, allowAmbient bool) (username, password string, err error) {
 	hasConfig := false
 
 	klog.InfoS("CMI: Getting Infoblox User Data")
 	if cfg.UsernameSecretRef.Key != "" && cfg.PasswordSecretRef.Key != "" {
 		klog.InfoS("CMI: Getting Infoblox User and Password from secret")
 		hasConfig = true
-		var err error
 		// Find secret credentials
-		username, err = c.getSecret(cfg.UsernameSecretRef, namespace)
+		username, err = c.getSecretRef(cfg.UsernameSecretRef, namespace)
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
 
-		password, err = c.getSecret(cfg.PasswordSecretRef, namespace)
+		password, err = c.getSecretRef(cfg.PasswordSecretRef, namespace)
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
 		klog.InfoS("CMI: Infoblox User", "username", username)
 	}
@@ -318,17 +554,17 @@ func (c *customDNSProviderSolver) getIbClient(cfg *customDNSProviderConfig, name
 		hasConfig = true
 
 		if _, err := os.Stat(SecretPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("CMI: File %s does not exist", SecretPath)
+			return "", "", fmt.Errorf("CMI: File %s does not exist", SecretPath)
 		}
 
 		fileData, err := os.ReadFile(SecretPath)
 		if err != nil {
-			return nil, err
+			return "", "", err
 		}
 
 		var creds usernamePassword
 		if err := json.Unmarshal(fileData, &creds); err != nil {
-			return nil, err
+			return "", "", err
 		}
 
 		username = creds.Username
@@ -337,33 +573,9 @@ func (c *customDNSProviderSolver) getIbClient(cfg *customDNSProviderConfig, name
 	}
 
 	if !hasConfig {
-		return nil, fmt.Errorf("CMI: No secretRefs or secretPath provided")
-	}
-
-	// Initialize ibclient
-	hostConfig := ibclient.HostConfig{
-		Host:    cfg.Host,
-		Version: cfg.Version,
-		Port:    cfg.Port,
-	}
-
-	// Initialize the auth config for ibclient
-	authConfig := ibclient.AuthConfig{
-		Username: username,
-		Password: password,
-	}
-
-	transportConfig := ibclient.NewTransportConfig(strconv.FormatBool(cfg.SslVerify), cfg.HTTPRequestTimeout, cfg.HTTPPoolConnections)
-	requestBuilder := &ibclient.WapiRequestBuilder{}
-	requestor := &ibclient.WapiHttpRequestor{}
-
-	ib, err := ibclient.NewConnector(hostConfig, authConfig, transportConfig, requestBuilder, requestor)
-	if err != nil {
-		klog.InfoS("CMI: Error creating Infoblox client", "error", err.Error())
-		return nil, err
+		return c.ambientCredentials(namespace, allowAmbient)
 	}
-
-	return ib, nil
+	return username, password, nil
 }
 
 // Resolve the value of a secret given a SecretKeySelector with name and key parameters
@@ -385,57 +597,110 @@ func (c *customDNSProviderSolver) getSecret(sel cmmeta.SecretKeySelector, namesp
 	return strings.TrimSuffix(string(secretData), "\n"), nil
 }
 
-// Get the ref for TXT record in InfoBlox given its name, text and view
-func (c *customDNSProviderSolver) GetTXTRecord(ib ibclient.IBConnector, name string, text string, view string) (string, error) {
-	klog.InfoS("CMI: Getting TXT record", "name", name)
+// challengeRecordName returns the name of the TXT record for the challenge:
+// the normalized challenge name, after applying challengeRelocation and
+// following any CNAME at the name inside the view. With a shared record group
+// it also defaults the zone shared record names are relative to. The final
+// name must be allowed by the zone policy for op.
+func (c *customDNSProviderSolver) challengeRecordName(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest, op string) (string, error) {
+	name, err := normalizeFQDN(ch.ResolvedFQDN)
+	if err != nil {
+		return "", err
+	}
+	if cfg.SharedRecordGroup != "" && cfg.SharedRecordZone == "" {
+		if cfg.SharedRecordZone, err = normalizeFQDN(ch.ResolvedZone); err != nil {
+			return "", err
+		}
+	}
+	name, err = c.relocateChallenge(ib, cfg, name)
+	if err != nil {
+		return "", err
+	}
+	name, err = c.followCNAMEs(ib, name, cfg.View)
+	if err != nil {
+		return "", err
+	}
+	return name, c.authorizeRecordName(ch, op, name)
+}
+
+// Get the refs of every TXT record in InfoBlox matching name and text, in the
+// configured view, or in the shared record group when one is configured.
+// Races or manual retries can leave duplicates behind, so there may be more
+// than one.
+func (c *customDNSProviderSolver) GetTXTRecords(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name string, text string) ([]string, error) {
+	if cfg.SharedRecordGroup != "" {
+		return c.getSharedTXTRecords(ib, cfg, name, text)
+	}
+
+	klog.InfoS("CMI: Getting TXT records", "name", name)
 	var records []ibclient.RecordTXT
 	recordTXT := ibclient.NewEmptyRecordTXT()
 	params := map[string]string{
 		"name": name,
 		"text": text,
-		"view": view,
+		"view": cfg.View,
 	}
 	err := ib.GetObject(recordTXT, "", ibclient.NewQueryParams(false, params), &records)
 	klog.InfoS("CMI: Number of records is", "number", strconv.Itoa(len(records)))
 
 	if len(records) > 0 {
 		klog.InfoS("CMI: Found TXT record")
-		return records[0].Ref, nil
+		refs := make([]string, 0, len(records))
+		for _, record := range records {
+			refs = append(refs, record.Ref)
+		}
+		return refs, nil
 	}
 
 	// No records found - check if it's a NotFoundError (expected) or real error
 	var notFoundErr *ibclient.NotFoundError
 	if errors.As(err, &notFoundErr) {
 		klog.InfoS("CMI: No TXT record found. This can be normal for the first run.")
-		return "", nil
+		return nil, nil
 	}
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return "", nil
+	return nil, nil
 }
 
-// Create a TXT record in Infoblox
-func (c *customDNSProviderSolver) CreateTXTRecord(ib ibclient.IBConnector, name string, text string, view string, ttl uint32, useTTL bool) (string, error) {
+// Create a TXT record in Infoblox, in the configured view or shared record
+// group, through the cloud object manager in cloud mode
+func (c *customDNSProviderSolver) CreateTXTRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name string, text string) (string, error) {
+	if cfg.SharedRecordGroup != "" {
+		return c.createSharedTXTRecord(ib, cfg, name, text)
+	}
+	if cfg.Cloud != nil {
+		return c.createCloudTXTRecord(ib, cfg, name, text)
+	}
+
 	klog.InfoS("CMI: Creating TXT record", "name", name)
 
-	recordTXT := ibclient.NewRecordTXT(view, "", name, text, ttl, useTTL, "", nil)
+	recordTXT := ibclient.NewRecordTXT(cfg.View, "", name, text, cfg.TTL, cfg.UseTTL, cfg.comment, nil)
+	if cfg.DynamicRecords {
+		recordTXT.Creator = creatorDynamic
+		recordTXT.DdnsPrincipal = &cfg.DDNSPrincipal
+	}
 	klog.InfoS("CMI: RecordTXT", "recordTXT", recordTXT)
 	return ib.CreateObject(recordTXT)
 }
 
-// Delete a TXT record in Infoblox by ref
-func (c *customDNSProviderSolver) DeleteTXTRecord(ib ibclient.IBConnector, ref string) error {
+// Delete a TXT record in Infoblox by ref, after confirming the ref still
+// points at the challenge's name, text and view or shared record group. Where the Grid supports
+// multi-object requests the delete is guarded by a transaction as well.
+func (c *customDNSProviderSolver) DeleteTXTRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref string, name string, text string) error {
 	klog.InfoS("CMI: Deleting TXT record", "ref", ref)
-	_, err := ib.DeleteObject(ref)
+	gone, err := c.checkBeforeDelete(ib, cfg, ref, name, text)
+	if gone || err != nil {
+		return err
+	}
 
-	return err
-}
+	if handled, err := c.deleteGuarded(ib, cfg, ref, name, text); handled {
+		return err
+	}
 
-// DeDot removes the trailing dot from a fully qualified domain name.
-func (c *customDNSProviderSolver) DeDot(fqdn string) string {
-	klog.InfoS("CMI: Removing trailing dot")
-	return strings.TrimSuffix(fqdn, ".")
+	_, err = ib.DeleteObject(ref)
+	return err
 }
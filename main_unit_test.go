@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,55 +23,79 @@ func TestName(t *testing.T) {
 	assert.Equal(t, "infoblox-wapi", solver.Name())
 }
 
-// TestDeDot verifies trailing dot removal from FQDNs
-func TestDeDot(t *testing.T) {
-	solver := &customDNSProviderSolver{}
-
+// TestNormalizeFQDN verifies names are lowercased, IDNs are converted to a
+// single form and malformed names are rejected
+func TestNormalizeFQDN(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
 		expected string
+		wantErr  string
 	}{
-		{
-			name:     "FQDN with trailing dot",
-			input:    "example.com.",
-			expected: "example.com",
-		},
-		{
-			name:     "FQDN without trailing dot",
-			input:    "example.com",
-			expected: "example.com",
-		},
-		{
-			name:     "subdomain with trailing dot",
-			input:    "_acme-challenge.example.com.",
-			expected: "_acme-challenge.example.com",
-		},
-		{
-			name:     "empty string",
-			input:    "",
-			expected: "",
-		},
-		{
-			name:     "just a dot",
-			input:    ".",
-			expected: "",
-		},
-		{
-			name:     "multiple dots in middle",
-			input:    "sub.domain.example.com.",
-			expected: "sub.domain.example.com",
-		},
+		{name: "trailing dot", input: "_acme-challenge.example.com.", expected: "_acme-challenge.example.com"},
+		{name: "mixed case", input: "_ACME-Challenge.Example.COM.", expected: "_acme-challenge.example.com"},
+		{name: "unicode", input: "_acme-challenge.bücher.example.", expected: "_acme-challenge.bücher.example"},
+		{name: "uppercase unicode", input: "_acme-challenge.BÜCHER.example.", expected: "_acme-challenge.bücher.example"},
+		{name: "punycode", input: "_acme-challenge.xn--bcher-kva.example.", expected: "_acme-challenge.bücher.example"},
+		{name: "empty", input: "", wantErr: "empty"},
+		{name: "just a dot", input: ".", wantErr: "empty"},
+		{name: "empty label", input: "_acme-challenge..example.com", wantErr: "empty label"},
+		{name: "leading dot", input: ".example.com", wantErr: "empty label"},
+		{name: "label too long", input: strings.Repeat("a", 64) + ".example.com", wantErr: "longer than 63"},
+		{name: "name too long", input: strings.Repeat(strings.Repeat("a", 60)+".", 5) + "com", wantErr: "longer than 253"},
+		{name: "space", input: "_acme-challenge.exa mple.com", wantErr: "Invalid domain name"},
+		{name: "wildcard", input: "*.example.com", wantErr: "Invalid domain name"},
+		{name: "leading hyphen", input: "-foo.example.com", wantErr: "invalid label"},
+		{name: "invalid punycode", input: "xn--a.example.com", wantErr: "Invalid domain name"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := solver.DeDot(tt.input)
+			result, err := normalizeFQDN(tt.input)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
 
+// FuzzNormalizeFQDN verifies normalized names are stable, lowercase, have no
+// trailing dot and stay within the DNS length limits
+func FuzzNormalizeFQDN(f *testing.F) {
+	for _, seed := range []string{
+		"_acme-challenge.example.com.",
+		"_ACME-CHALLENGE.Example.COM",
+		"_acme-challenge.bücher.example.",
+		"_acme-challenge.xn--bcher-kva.example",
+		"a..b",
+		".",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result, err := normalizeFQDN(input)
+		if err != nil {
+			return
+		}
+		assert.Equal(t, strings.ToLower(result), result)
+		assert.False(t, strings.HasSuffix(result, "."))
+
+		again, err := normalizeFQDN(result)
+		require.NoError(t, err)
+		assert.Equal(t, result, again)
+
+		ascii, err := idnaProfile.ToASCII(result)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(ascii), maxNameLength)
+	})
+}
+
 // TestLoadConfig_Valid tests successful configuration parsing
 func TestLoadConfig_Valid(t *testing.T) {
 	configJSON := `{
@@ -86,7 +111,7 @@ func TestLoadConfig_Valid(t *testing.T) {
 	}`
 
 	raw := apiextensionsv1.JSON{Raw: []byte(configJSON)}
-	cfg, err := loadConfig(&raw)
+	cfg, err := loadConfig(&raw, nil)
 
 	require.NoError(t, err)
 	assert.Equal(t, "infoblox.example.com", cfg.Host)
@@ -102,7 +127,7 @@ func TestLoadConfig_Valid(t *testing.T) {
 
 // TestLoadConfig_Nil tests the base case with no configuration
 func TestLoadConfig_Nil(t *testing.T) {
-	cfg, err := loadConfig(nil)
+	cfg, err := loadConfig(nil, nil)
 
 	require.NoError(t, err)
 	// Should get zero values
@@ -112,7 +137,7 @@ func TestLoadConfig_Nil(t *testing.T) {
 // TestLoadConfig_Empty tests with empty JSON object
 func TestLoadConfig_Empty(t *testing.T) {
 	raw := apiextensionsv1.JSON{Raw: []byte("{}")}
-	cfg, err := loadConfig(&raw)
+	cfg, err := loadConfig(&raw, nil)
 
 	require.NoError(t, err)
 	assert.Equal(t, "", cfg.Host)
@@ -121,7 +146,7 @@ func TestLoadConfig_Empty(t *testing.T) {
 // TestLoadConfig_InvalidJSON tests error handling for malformed JSON
 func TestLoadConfig_InvalidJSON(t *testing.T) {
 	raw := apiextensionsv1.JSON{Raw: []byte("invalid json")}
-	_, err := loadConfig(&raw)
+	_, err := loadConfig(&raw, nil)
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Error decoding solver config")
@@ -139,7 +164,7 @@ func TestApplyDefaults(t *testing.T) {
 			input: customDNSProviderConfig{},
 			expected: customDNSProviderConfig{
 				Port:                "443",
-				Version:             "2.10",
+				Version:             "auto",
 				HTTPRequestTimeout:  60,
 				HTTPPoolConnections: 10,
 				TTL:                 300,
@@ -183,7 +208,7 @@ func TestApplyDefaults(t *testing.T) {
 			},
 			expected: customDNSProviderConfig{
 				Port:                "443",
-				Version:             "2.10",
+				Version:             "auto",
 				HTTPRequestTimeout:  60,
 				HTTPPoolConnections: 10,
 				TTL:                 300,
@@ -206,13 +231,13 @@ func TestLoadConfig_WithDefaults(t *testing.T) {
 	configJSON := `{"host": "infoblox.example.com"}`
 	raw := apiextensionsv1.JSON{Raw: []byte(configJSON)}
 
-	cfg, err := loadConfig(&raw)
+	cfg, err := loadConfig(&raw, nil)
 
 	require.NoError(t, err)
 	assert.Equal(t, "infoblox.example.com", cfg.Host)
 	// Check defaults were applied
 	assert.Equal(t, "443", cfg.Port)
-	assert.Equal(t, "2.10", cfg.Version)
+	assert.Equal(t, "auto", cfg.Version)
 	assert.Equal(t, 60, cfg.HTTPRequestTimeout)
 	assert.Equal(t, 10, cfg.HTTPPoolConnections)
 	assert.Equal(t, uint32(300), cfg.TTL)
@@ -329,23 +354,23 @@ func TestGetIbClient_WithSecretRefs(t *testing.T) {
 		Host:    "infoblox.example.com",
 		Port:    "443",
 		Version: "2.10",
-		UsernameSecretRef: cmmeta.SecretKeySelector{
+		UsernameSecretRef: secretKeySelector{SecretKeySelector: cmmeta.SecretKeySelector{
 			LocalObjectReference: cmmeta.LocalObjectReference{
 				Name: "infoblox-creds",
 			},
 			Key: "username",
-		},
-		PasswordSecretRef: cmmeta.SecretKeySelector{
+		}},
+		PasswordSecretRef: secretKeySelector{SecretKeySelector: cmmeta.SecretKeySelector{
 			LocalObjectReference: cmmeta.LocalObjectReference{
 				Name: "infoblox-creds",
 			},
 			Key: "password",
-		},
+		}},
 		HTTPRequestTimeout:  60,
 		HTTPPoolConnections: 10,
 	}
 
-	ib, err := solver.getIbClient(&cfg, "test-namespace")
+	ib, err := solver.getIbClient(&cfg, "test-namespace", false)
 
 	require.NoError(t, err)
 	assert.NotNil(t, ib)
@@ -361,7 +386,7 @@ func TestGetIbClient_NoCredentials(t *testing.T) {
 		Version: "2.10",
 	}
 
-	_, err := solver.getIbClient(&cfg, "test-namespace")
+	_, err := solver.getIbClient(&cfg, "test-namespace", false)
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "No secretRefs or secretPath provided")
@@ -398,7 +423,7 @@ func TestGetIbClient_VolumeFileNotFound(t *testing.T) {
 		GetUserFromVolume: true,
 	}
 
-	_, err := solver.getIbClient(&cfg, "test-namespace")
+	_, err := solver.getIbClient(&cfg, "test-namespace", false)
 
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "does not exist")
@@ -423,32 +448,38 @@ func TestGetIbClient_WithDefaultsFromLoadConfig(t *testing.T) {
 	// Simulate config loaded through loadConfig (which applies defaults)
 	cfg := customDNSProviderConfig{
 		Host: "infoblox.example.com",
-		UsernameSecretRef: cmmeta.SecretKeySelector{
+		UsernameSecretRef: secretKeySelector{SecretKeySelector: cmmeta.SecretKeySelector{
 			LocalObjectReference: cmmeta.LocalObjectReference{
 				Name: "infoblox-creds",
 			},
 			Key: "username",
-		},
-		PasswordSecretRef: cmmeta.SecretKeySelector{
+		}},
+		PasswordSecretRef: secretKeySelector{SecretKeySelector: cmmeta.SecretKeySelector{
 			LocalObjectReference: cmmeta.LocalObjectReference{
 				Name: "infoblox-creds",
 			},
 			Key: "password",
-		},
+		}},
 	}
 	// Apply defaults as loadConfig would do
 	applyDefaults(&cfg)
 
-	ib, err := solver.getIbClient(&cfg, "test-namespace")
-
-	require.NoError(t, err)
-	assert.NotNil(t, ib)
 	// Verify defaults were applied by applyDefaults (simulating loadConfig behavior)
 	assert.Equal(t, "443", cfg.Port)
-	assert.Equal(t, "2.10", cfg.Version)
+	assert.Equal(t, "auto", cfg.Version)
 	assert.Equal(t, 60, cfg.HTTPRequestTimeout)
 	assert.Equal(t, 10, cfg.HTTPPoolConnections)
 	assert.Equal(t, uint32(300), cfg.TTL)
+
+	// The "auto" version is negotiated with the Grid, so point at a fake WAPI
+	f := newFakeWAPI(t)
+	cfg.Host, cfg.Port = f.hostPort()
+
+	ib, err := solver.getIbClient(&cfg, "test-namespace", false)
+
+	require.NoError(t, err)
+	assert.NotNil(t, ib)
+	assert.Equal(t, "2.12", cfg.Version)
 }
 
 // TestInitialize tests the Initialize method
@@ -460,16 +491,6 @@ func TestInitialize(t *testing.T) {
 }
 
 // Benchmark tests for performance-critical functions
-func BenchmarkDeDot(b *testing.B) {
-	solver := &customDNSProviderSolver{}
-	input := "_acme-challenge.example.com."
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		solver.DeDot(input)
-	}
-}
-
 func BenchmarkLoadConfig(b *testing.B) {
 	configJSON := `{
 		"host": "infoblox.example.com",
@@ -481,7 +502,7 @@ func BenchmarkLoadConfig(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = loadConfig(&raw)
+		_, _ = loadConfig(&raw, nil)
 	}
 }
 
@@ -558,8 +579,53 @@ func TestLoadConfig_Combinations(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			raw := apiextensionsv1.JSON{Raw: []byte(tt.configJSON)}
-			cfg, err := loadConfig(&raw)
+			cfg, err := loadConfig(&raw, nil)
 			tt.validate(t, cfg, err)
 		})
 	}
 }
+
+// TestCleanUp_RemovesDuplicates verifies every record matching the challenge
+// is deleted while records with another value are kept
+func TestCleanUp_RemovesDuplicates(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+	record := map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-1", "view": "default"}
+	for i := 0; i < 3; i++ {
+		f.add("record:txt", record)
+	}
+	f.add("record:txt", map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-2", "view": "default"})
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)
+
+	// Present sees the duplicates and leaves them alone
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", map[string]string{"text": "key-1"}), 3)
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("record:txt", map[string]string{"text": "key-1"}))
+	assert.Len(t, f.find("record:txt", map[string]string{"text": "key-2"}), 1)
+}
+
+// TestCleanUp_CollectsDeleteErrors verifies a failing delete does not stop the
+// remaining duplicates from being deleted and is reported with its ref
+func TestCleanUp_CollectsDeleteErrors(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+	record := map[string]interface{}{"name": "_acme-challenge.example.com", "text": "key-1", "view": "default"}
+	failing := f.add("record:txt", record)
+	f.add("record:txt", record)
+	f.add("record:txt", record)
+	f.failDeletes = map[string]bool{failing: true}
+	// Delete by ref, a guarded delete may pick the failing duplicate first
+	f.noBatch = true
+
+	err := solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), failing)
+	remaining := f.find("record:txt", nil)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, failing, remaining[0]["_ref"])
+}
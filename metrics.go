@@ -0,0 +1,62 @@
+package main
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// Metrics are registered with the legacy registry, which is what the
+// webhook's generic apiserver serves on /metrics.
+const metricsNamespace = "infoblox_wapi_webhook"
+
+// wapiVersionInfo reports the WAPI version in use for each Grid. The value is
+// always 1; the version is carried in the label, as with build_info metrics.
+var wapiVersionInfo = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "wapi_version_info",
+		Help:           "WAPI version used for each Grid and whether it was negotiated or configured.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"grid", "version", "source"},
+)
+
+// wapiAuthentications counts requests sent with basic auth, i.e. full logins
+// on the Grid, as opposed to requests riding an existing session cookie.
+var wapiAuthentications = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace:      metricsNamespace,
+		Name:           "wapi_authentications_total",
+		Help:           "Number of WAPI requests that authenticated with basic auth instead of a session cookie.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"grid"},
+)
+
+// zoneScavengingInfo reports whether DNS scavenging is enabled on the zones
+// dynamic TXT records are created in.
+var zoneScavengingInfo = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Namespace:      metricsNamespace,
+		Name:           "zone_scavenging_enabled",
+		Help:           "Whether DNS scavenging is enabled on a zone dynamic TXT records are created in (1) or not (0).",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"grid", "view", "zone"},
+)
+
+// mirrorOperations counts the outcome of mirrored challenges on each Grid,
+// so a mirror that has fallen behind the primary shows up.
+var mirrorOperations = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace:      metricsNamespace,
+		Name:           "mirror_operations_total",
+		Help:           "Number of mirrored Present and CleanUp operations on each Grid, by role and result.",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"grid", "role", "operation", "result"},
+)
+
+func init() {
+	legacyregistry.MustRegister(wapiVersionInfo, wapiAuthentications, zoneScavengingInfo, mirrorOperations)
+}
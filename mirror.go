@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// Values of mirror.onPartialFailure, which decides the result of Present and
+// CleanUp when only one of the two Grids succeeds. When both fail, the
+// challenge always fails.
+const (
+	// mirrorFail fails the challenge. This is the default.
+	mirrorFail = "fail"
+	// mirrorWarn logs the failing Grid and succeeds.
+	mirrorWarn = "warn"
+	// mirrorPrimaryOnly succeeds when the primary Grid does, whatever the
+	// mirror's outcome.
+	mirrorPrimaryOnly = "primary-only"
+)
+
+// Roles of the Grids a mirrored challenge is applied to, as logged and in
+// metrics.
+const (
+	rolePrimary = "primary"
+	roleMirror  = "mirror"
+)
+
+// mirrorConfig names a second Grid that every challenge is also written to,
+// e.g. while delegations are migrated from an old Grid to a new one. Unset
+// credentials, view, sslVerify and caBundle are taken from the primary
+// connection.
+type mirrorConfig struct {
+	Host              string            `json:"host"`
+	Port              string            `json:"port"`
+	Version           string            `json:"version"`
+	UsernameSecretRef secretKeySelector `json:"usernameSecretRef"`
+	PasswordSecretRef secretKeySelector `json:"passwordSecretRef"`
+	View              string            `json:"view"`
+	SslVerify         *bool             `json:"sslVerify"`
+	CABundle          string            `json:"caBundle"`
+	OnPartialFailure  string            `json:"onPartialFailure"`
+}
+
+// validateMirror checks the mirror block and applies its defaults.
+func validateMirror(cfg *customDNSProviderConfig) error {
+	m := cfg.Mirror
+	if m == nil {
+		return nil
+	}
+	if m.Host == "" {
+		return fmt.Errorf("CMI: mirror.host is required")
+	}
+	if m.Port == "" {
+		m.Port = "443"
+	}
+	if m.Version == "" {
+		m.Version = versionAuto
+	}
+	if m.Host == cfg.Host && m.Port == cfg.Port {
+		return fmt.Errorf("CMI: mirror must name a different Grid than host")
+	}
+	if m.CABundle != "" {
+		if _, err := wapiTLSConfig(&customDNSProviderConfig{CABundle: m.CABundle}); err != nil {
+			return fmt.Errorf("CMI: Invalid mirror.caBundle: %w", err)
+		}
+	}
+	switch m.OnPartialFailure {
+	case "":
+		m.OnPartialFailure = mirrorFail
+	case mirrorFail, mirrorWarn, mirrorPrimaryOnly:
+	default:
+		return fmt.Errorf("CMI: Invalid mirror.onPartialFailure %q, must be one of %q, %q or %q", m.OnPartialFailure, mirrorFail, mirrorWarn, mirrorPrimaryOnly)
+	}
+	return nil
+}
+
+// mirrorTarget returns the config for the mirror Grid, or nil when no mirror
+// is configured. It is a copy of cfg with the mirror's connection, so record
+// options such as ttl and challengeRelocation apply to both Grids. The
+// RFC 2136 fallback only applies to the primary Grid.
+func mirrorTarget(cfg *customDNSProviderConfig) *customDNSProviderConfig {
+	m := cfg.Mirror
+	if m == nil {
+		return nil
+	}
+	target := *cfg
+	target.Mirror = nil
+	target.RFC2136 = nil
+	target.Host, target.Port, target.Version = m.Host, m.Port, m.Version
+	if m.UsernameSecretRef.Name != "" || m.PasswordSecretRef.Name != "" {
+		target.UsernameSecretRef, target.PasswordSecretRef = m.UsernameSecretRef, m.PasswordSecretRef
+	}
+	if m.View != "" {
+		target.View = m.View
+	}
+	if m.SslVerify != nil {
+		target.SslVerify = *m.SslVerify
+	}
+	if m.CABundle != "" {
+		target.CABundle = m.CABundle
+	}
+	return &target
+}
+
+// withMirror applies the challenge to the mirror Grid, if any, and combines
+// its outcome with primaryErr, the primary Grid's, according to
+// mirror.onPartialFailure. Each Grid's outcome is logged and counted.
+func (c *customDNSProviderSolver) withMirror(primary, mirror *customDNSProviderConfig, ch *whapi.ChallengeRequest, op string, primaryErr error, apply func(*customDNSProviderConfig, *whapi.ChallengeRequest) error) error {
+	if mirror == nil {
+		return primaryErr
+	}
+	recordMirrorOutcome(primary, rolePrimary, op, ch, primaryErr)
+	mirrorErr := apply(mirror, ch)
+	recordMirrorOutcome(mirror, roleMirror, op, ch, mirrorErr)
+	if mirrorErr != nil {
+		mirrorErr = fmt.Errorf("CMI: mirror Grid %s: %w", gridKey(mirror), mirrorErr)
+	}
+
+	switch {
+	case primaryErr == nil && mirrorErr == nil:
+		return nil
+	case primaryErr != nil && mirrorErr != nil:
+		return errors.Join(primaryErr, mirrorErr)
+	}
+
+	mode := primary.Mirror.OnPartialFailure
+	if mode == mirrorFail || (mode == mirrorPrimaryOnly && primaryErr != nil) {
+		return errors.Join(primaryErr, mirrorErr)
+	}
+	klog.InfoS("CMI: WARNING: Challenge only applied to one Grid, the Grids have diverged", "op", op, "DNS", ch.DNSName, "onPartialFailure", mode, "error", errors.Join(primaryErr, mirrorErr).Error())
+	return nil
+}
+
+// recordMirrorOutcome logs and counts the outcome of a mirrored challenge on
+// one Grid.
+func recordMirrorOutcome(cfg *customDNSProviderConfig, role, op string, ch *whapi.ChallengeRequest, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		klog.InfoS("CMI: Mirrored challenge failed", "op", op, "role", role, "grid", gridKey(cfg), "DNS", ch.DNSName, "error", err.Error())
+	} else {
+		klog.InfoS("CMI: Mirrored challenge succeeded", "op", op, "role", role, "grid", gridKey(cfg), "DNS", ch.DNSName)
+	}
+	mirrorOperations.WithLabelValues(gridKey(cfg), role, op, result).Inc()
+}
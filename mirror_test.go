@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateMirror verifies the mirror block's defaults and validation
+func TestValidateMirror(t *testing.T) {
+	tests := []struct {
+		name     string
+		mirror   *mirrorConfig
+		wantMode string
+		wantErr  string
+	}{
+		{name: "disabled"},
+		{name: "defaults", mirror: &mirrorConfig{Host: "new-gm.example.com"}, wantMode: mirrorFail},
+		{name: "warn", mirror: &mirrorConfig{Host: "new-gm.example.com", OnPartialFailure: mirrorWarn}, wantMode: mirrorWarn},
+		{name: "missing host", mirror: &mirrorConfig{}, wantErr: "mirror.host is required"},
+		{name: "same grid", mirror: &mirrorConfig{Host: "gm.example.com"}, wantErr: "different Grid"},
+		{name: "invalid caBundle", mirror: &mirrorConfig{Host: "new-gm.example.com", CABundle: "not a certificate"}, wantErr: "Invalid mirror.caBundle"},
+		{name: "unknown mode", mirror: &mirrorConfig{Host: "new-gm.example.com", OnPartialFailure: "ignore"}, wantErr: "Invalid mirror.onPartialFailure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := customDNSProviderConfig{Host: "gm.example.com", Port: "443", Mirror: tt.mirror}
+			err := validateMirror(&cfg)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.mirror != nil {
+				assert.Equal(t, tt.wantMode, tt.mirror.OnPartialFailure)
+				assert.Equal(t, "443", tt.mirror.Port)
+				assert.Equal(t, versionAuto, tt.mirror.Version)
+			}
+		})
+	}
+}
+
+// TestMirrorTarget verifies the mirror config inherits record options and
+// unset connection fields from the primary, without the RFC 2136 fallback
+func TestMirrorTarget(t *testing.T) {
+	cfg, err := loadConfig(rfc2136Challenge(t, "gm.example.com", "443", []string{"10.0.0.1"}, map[string]interface{}{
+		"ttl":    60,
+		"mirror": map[string]interface{}{"host": "new-gm.example.com", "view": "internal"},
+	}).Config, nil)
+	require.NoError(t, err)
+
+	target := mirrorTarget(&cfg)
+	require.NotNil(t, target)
+	assert.Equal(t, "new-gm.example.com:443", gridKey(target))
+	assert.Equal(t, "internal", target.View)
+	assert.Equal(t, cfg.UsernameSecretRef, target.UsernameSecretRef)
+	assert.Equal(t, uint32(60), target.TTL)
+	assert.Nil(t, target.RFC2136)
+	assert.Nil(t, target.Mirror)
+	assert.Equal(t, "default", cfg.View)
+}
+
+// TestPresentCleanUp_Mirror verifies challenges are written to and removed
+// from both Grids
+func TestPresentCleanUp_Mirror(t *testing.T) {
+	primary, mirror := newFakeWAPI(t), newFakeWAPI(t)
+	host, port := mirror.hostPort()
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, primary, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{
+		"view":    "default",
+		"version": "2.10",
+		"mirror":  map[string]interface{}{"host": host, "port": port, "version": "2.10"},
+	})
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(ch))
+	for _, f := range []*fakeWAPI{primary, mirror} {
+		assert.Len(t, f.find("record:txt", map[string]string{"name": "_acme-challenge.app.example.com", "text": "key-1", "view": "default"}), 1)
+	}
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, primary.find("record:txt", nil))
+	assert.Empty(t, mirror.find("record:txt", nil))
+}
+
+// TestPresent_MirrorPartialFailure verifies onPartialFailure decides the
+// result when only one Grid can be reached
+func TestPresent_MirrorPartialFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		primaryDown bool
+		mirrorDown  bool
+		wantErr     bool
+	}{
+		{name: "fail, mirror down", mode: mirrorFail, mirrorDown: true, wantErr: true},
+		{name: "warn, mirror down", mode: mirrorWarn, mirrorDown: true},
+		{name: "warn, primary down", mode: mirrorWarn, primaryDown: true},
+		{name: "warn, both down", mode: mirrorWarn, primaryDown: true, mirrorDown: true, wantErr: true},
+		{name: "primary-only, mirror down", mode: mirrorPrimaryOnly, mirrorDown: true},
+		{name: "primary-only, primary down", mode: mirrorPrimaryOnly, primaryDown: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, mirror := newFakeWAPI(t), newFakeWAPI(t)
+			mirrorHost, mirrorPort := mirror.hostPort()
+			if tt.mirrorDown {
+				mirrorHost, mirrorPort = unreachableAddr(t)
+			}
+			extra := map[string]interface{}{
+				"view":    "default",
+				"version": "2.10",
+				"mirror":  map[string]interface{}{"host": mirrorHost, "port": mirrorPort, "version": "2.10", "onPartialFailure": tt.mode},
+			}
+			if tt.primaryDown {
+				extra["host"], extra["port"] = unreachableAddr(t)
+			}
+
+			err := newFakeWAPISolver().Present(fakeChallenge(t, primary, "_acme-challenge.example.com.", "key-1", extra))
+			if tt.wantErr {
+				require.Error(t, err)
+				if tt.mirrorDown {
+					assert.Contains(t, err.Error(), "mirror Grid")
+				}
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, !tt.primaryDown, len(primary.find("record:txt", nil)) == 1)
+			assert.Equal(t, !tt.mirrorDown, len(mirror.find("record:txt", nil)) == 1)
+		})
+	}
+}
+
+// serveWithOwnCA restarts f with a certificate signed by a CA of its own, as
+// httptest servers otherwise share one, and returns that CA as a bundle.
+func serveWithOwnCA(t *testing.T, f *fakeWAPI) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "mirror-ca"},
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	f.server.Close()
+	f.server = httptest.NewUnstartedServer(http.HandlerFunc(f.serveHTTP))
+	f.server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}, MinVersion: tls.VersionTLS12}
+	f.server.StartTLS()
+	t.Cleanup(f.server.Close)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// TestPresent_MirrorCABundle verifies a mirror Grid signed by another CA is
+// verified against mirror.caBundle rather than the primary's
+func TestPresent_MirrorCABundle(t *testing.T) {
+	primary, mirror := newFakeWAPI(t), newFakeWAPI(t)
+	primaryBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: primary.server.Certificate().Raw}))
+	mirrorBundle := serveWithOwnCA(t, mirror)
+	host, port := mirror.hostPort()
+	solver := newFakeWAPISolver()
+
+	mirrorCfg := map[string]interface{}{"host": host, "port": port, "version": "2.10"}
+	extra := map[string]interface{}{"view": "default", "version": "2.10", "sslVerify": true, "caBundle": primaryBundle, "mirror": mirrorCfg}
+	err := solver.Present(fakeChallenge(t, primary, "_acme-challenge.example.com.", "key-1", extra))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mirror Grid")
+	assert.Contains(t, err.Error(), "certificate")
+
+	mirrorCfg["caBundle"] = mirrorBundle
+	require.NoError(t, solver.Present(fakeChallenge(t, primary, "_acme-challenge.example.com.", "key-1", extra)))
+	assert.Len(t, primary.find("record:txt", nil), 1)
+	assert.Len(t, mirror.find("record:txt", nil), 1)
+}
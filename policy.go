@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// ZonePolicyFileEnv names the environment variable holding the path of the
+// zone policy file, usually mounted from a ConfigMap.
+const ZonePolicyFileEnv = "ZONE_POLICY_FILE"
+
+// anyNamespace in a rule's namespaces matches every namespace.
+const anyNamespace = "*"
+
+// zonePolicy limits the zones challenges from each namespace may write to.
+// With a policy in place, a namespace no rule matches may not write anywhere.
+type zonePolicy struct {
+	Rules []zonePolicyRule `json:"rules"`
+}
+
+// zonePolicyRule allows challenges from its namespaces to write names in its
+// zones, or below them.
+type zonePolicyRule struct {
+	Namespaces []string `json:"namespaces"`
+	Zones      []string `json:"zones"`
+}
+
+// zonePolicyFile is the zone policy named by ZONE_POLICY_FILE, if any.
+var zonePolicyFile = &reloadingFile[zonePolicy]{path: os.Getenv(ZonePolicyFileEnv), what: "zone policy", read: readZonePolicy}
+
+// readZonePolicy reads a zone policy in YAML or JSON and normalizes its
+// zones.
+func readZonePolicy(path string) (*zonePolicy, error) {
+	policy := &zonePolicy{}
+	if err := decodeFile(path, "zone policy", policy); err != nil {
+		return nil, err
+	}
+	for i, rule := range policy.Rules {
+		if len(rule.Namespaces) == 0 || len(rule.Zones) == 0 {
+			return nil, fmt.Errorf("CMI: zone policy rule %d needs namespaces and zones", i)
+		}
+		for j, zone := range rule.Zones {
+			normalized, err := normalizeFQDN(zone)
+			if err != nil {
+				return nil, fmt.Errorf("CMI: zone policy rule %d: invalid zone %q: %w", i, zone, err)
+			}
+			rule.Zones[j] = normalized
+		}
+	}
+	klog.InfoS("CMI: Loaded zone policy", "path", path, "rules", len(policy.Rules))
+	return policy, nil
+}
+
+// zonesFor returns the zones challenges from namespace may write to.
+func (p *zonePolicy) zonesFor(namespace string) []string {
+	var zones []string
+	for _, rule := range p.Rules {
+		for _, ns := range rule.Namespaces {
+			if ns == namespace || ns == anyNamespace {
+				zones = append(zones, rule.Zones...)
+				break
+			}
+		}
+	}
+	return zones
+}
+
+// inZones reports whether name is one of zones or below one of them.
+func inZones(name string, zones []string) bool {
+	for _, zone := range zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeChallenge enforces the zone policy, if any, before any WAPI call:
+// the challenge name, and the name challengeRelocation moves it to, must be
+// in a zone allowed for the challenge's namespace. Shared record groups
+// publish into every zone linked to the group, so they are denied while a
+// policy is in place. Each denial is logged as an audit line and recorded as
+// an Event.
+func (c *customDNSProviderSolver) authorizeChallenge(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest, op string) error {
+	policy, err := zonePolicyFile.get()
+	if err != nil || policy == nil {
+		return err
+	}
+
+	name, err := normalizeFQDN(ch.ResolvedFQDN)
+	if err != nil {
+		return err
+	}
+	if cfg.SharedRecordGroup != "" {
+		return c.denyChallenge(ch, op, name, policy.zonesFor(ch.ResourceNamespace),
+			fmt.Sprintf("sharedRecordGroup %s publishes outside the zones allowed by the zone policy", cfg.SharedRecordGroup))
+	}
+	names := []string{name}
+	if relocated, _, ok := relocate(cfg.ChallengeRelocation, name); ok {
+		names = append(names, relocated)
+	}
+	return c.authorizeNames(policy, ch, op, names...)
+}
+
+// authorizeRecordName enforces the zone policy, if any, on the name the TXT
+// record is written at, once CNAMEs at the challenge name have been followed.
+func (c *customDNSProviderSolver) authorizeRecordName(ch *whapi.ChallengeRequest, op, name string) error {
+	policy, err := zonePolicyFile.get()
+	if err != nil || policy == nil {
+		return err
+	}
+	return c.authorizeNames(policy, ch, op, name)
+}
+
+// authorizeNames checks that every name is in a zone policy allows for the
+// challenge's namespace.
+func (c *customDNSProviderSolver) authorizeNames(policy *zonePolicy, ch *whapi.ChallengeRequest, op string, names ...string) error {
+	zones := policy.zonesFor(ch.ResourceNamespace)
+	for _, name := range names {
+		if !inZones(name, zones) {
+			return c.denyChallenge(ch, op, name, zones, name+" is not in a zone allowed by the zone policy")
+		}
+	}
+	return nil
+}
+
+// denyChallenge logs and records the denial of a challenge and returns its
+// error.
+func (c *customDNSProviderSolver) denyChallenge(ch *whapi.ChallengeRequest, op, name string, zones []string, reason string) error {
+	klog.InfoS("CMI: AUDIT: Challenge denied by zone policy", "op", op, "namespace", ch.ResourceNamespace, "name", name, "dnsName", ch.DNSName, "uid", ch.UID, "allowedZones", zones)
+	message := fmt.Sprintf("Challenge for %s from namespace %s denied: %s", ch.DNSName, ch.ResourceNamespace, reason)
+	c.events.warning(reasonZonePolicyDenied, message)
+	return fmt.Errorf("CMI: %s", message)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// useZonePolicy installs a zone policy with the given content for the
+// duration of the test and returns its path.
+func useZonePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	previous := zonePolicyFile
+	zonePolicyFile = &reloadingFile[zonePolicy]{path: path, what: "zone policy", read: readZonePolicy}
+	t.Cleanup(func() { zonePolicyFile = previous })
+	return path
+}
+
+// TestReadZonePolicy verifies the zone policy is validated and its zones
+// normalized when it is read
+func TestReadZonePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{name: "valid", content: "rules:\n  - namespaces: [team-a]\n    zones: [Example.COM.]\n", want: []string{"example.com"}},
+		{name: "unknown key", content: "rules:\n  - namespace: team-a\n    zones: [example.com]\n", wantErr: "unknown field"},
+		{name: "no namespaces", content: "rules:\n  - zones: [example.com]\n", wantErr: "rule 0 needs namespaces and zones"},
+		{name: "no zones", content: "rules:\n  - namespaces: [team-a]\n", wantErr: "rule 0 needs namespaces and zones"},
+		{name: "invalid zone", content: "rules:\n  - namespaces: [team-a]\n    zones: [\"bad zone\"]\n", wantErr: "invalid zone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			policy, err := readZonePolicy(path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, policy.zonesFor("team-a"))
+		})
+	}
+}
+
+// TestPresent_ZonePolicy verifies challenges are only written to zones the
+// policy allows for their namespace, and denials make no WAPI requests
+func TestPresent_ZonePolicy(t *testing.T) {
+	useZonePolicy(t, `
+rules:
+  - namespaces: [test-namespace]
+    zones: [example.com]
+  - namespaces: ["*"]
+    zones: [shared.example.org]
+`)
+
+	tests := []struct {
+		name      string
+		fqdn      string
+		namespace string
+		extra     map[string]interface{}
+		cname     string
+		wantErr   string
+	}{
+		{name: "allowed zone", fqdn: "_acme-challenge.app.example.com.", namespace: "test-namespace"},
+		{name: "any namespace", fqdn: "_acme-challenge.app.shared.example.org.", namespace: "test-namespace"},
+		{name: "zone not allowed", fqdn: "_acme-challenge.app.example.net.", namespace: "test-namespace", wantErr: "_acme-challenge.app.example.net is not in a zone allowed"},
+		{name: "namespace not allowed", fqdn: "_acme-challenge.app.example.com.", namespace: "team-b", wantErr: "from namespace team-b denied"},
+		{
+			name:      "relocated outside allowed zones",
+			fqdn:      "_acme-challenge.app.example.com.",
+			namespace: "test-namespace",
+			extra:     map[string]interface{}{"challengeRelocation": []map[string]string{{"suffix": "example.com", "zone": "acme.example.net"}}},
+			wantErr:   "app.example.com.acme.example.net is not in a zone allowed",
+		},
+		{
+			name:      "CNAME outside allowed zones",
+			fqdn:      "_acme-challenge.example.com.",
+			namespace: "test-namespace",
+			cname:     "victim.other.org",
+			wantErr:   "victim.other.org is not in a zone allowed",
+		},
+		{
+			name:      "shared record group",
+			fqdn:      "_acme-challenge.app.example.com.",
+			namespace: "test-namespace",
+			extra:     map[string]interface{}{"sharedRecordGroup": "acme"},
+			wantErr:   "sharedRecordGroup acme publishes outside the zones allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			if tt.cname != "" {
+				addCNAME(f, "_acme-challenge.example.com", tt.cname)
+			}
+			solver := newFakeWAPISolver()
+			recorder := record.NewFakeRecorder(10)
+			solver.events = &eventEmitter{recorder: recorder, target: &corev1.ObjectReference{Kind: "Pod", Name: "webhook", Namespace: "cert-manager"}}
+			extra := map[string]interface{}{"view": "default", "version": "2.10"}
+			for k, v := range tt.extra {
+				extra[k] = v
+			}
+			ch := fakeChallenge(t, f, tt.fqdn, "key-1", extra)
+			ch.ResourceNamespace = tt.namespace
+
+			err := solver.Present(ch)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				assert.Len(t, f.find("record:txt", nil), 1)
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Zero(t, f.count("POST record:txt"))
+			assert.Empty(t, f.find("record:txt", nil))
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, reasonZonePolicyDenied)
+
+			require.Error(t, solver.CleanUp(ch))
+			assert.Zero(t, f.count("GET record:txt"))
+		})
+	}
+}
+
+// TestZonePolicyFile_Unreadable verifies challenges are denied when the
+// configured zone policy cannot be read
+func TestZonePolicyFile_Unreadable(t *testing.T) {
+	path := useZonePolicy(t, "rules: []\n")
+	require.NoError(t, os.Remove(path))
+	f := newFakeWAPI(t)
+
+	err := newFakeWAPISolver().Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "default"}))
+
+	require.Error(t, err)
+	assert.Zero(t, f.count("POST record:txt"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// reloadingFile holds a file read with read, reloaded when it changes, e.g.
+// when the kubelet updates a mounted ConfigMap.
+type reloadingFile[T any] struct {
+	path string
+	// what names the file in logs and errors.
+	what string
+	read func(path string) (*T, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	current *T
+}
+
+// get returns the current content, or nil when no path is configured. The
+// file is reloaded when its modification time or size changes. A file that
+// fails to load keeps the previous content in place.
+func (f *reloadingFile[T]) get() (*T, error) {
+	if f == nil || f.path == "" {
+		return nil, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if f.current != nil {
+			return f.current, nil
+		}
+		return nil, fmt.Errorf("CMI: Error reading %s: %w", f.what, err)
+	}
+	if f.current != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.current, nil
+	}
+
+	f.modTime, f.size = info.ModTime(), info.Size()
+	content, err := f.read(f.path)
+	if err != nil {
+		if f.current != nil {
+			klog.InfoS("CMI: Error reloading "+f.what+", keeping the previous one", "path", f.path, "error", err.Error())
+			return f.current, nil
+		}
+		return nil, err
+	}
+	f.current = content
+	return content, nil
+}
+
+// decodeFile decodes a YAML or JSON file into v, rejecting unknown fields.
+func decodeFile(path, what string, v interface{}) error {
+	raw, err := os.ReadFile(path) //nolint:gosec // G304: path is set by the operator
+	if err != nil {
+		return fmt.Errorf("CMI: Error reading %s: %w", what, err)
+	}
+	jsonRaw, err := yaml.YAMLToJSON(raw)
+	if err != nil {
+		return fmt.Errorf("CMI: Error parsing %s %s: %w", what, path, err)
+	}
+	if err := decodeStrict(jsonRaw, v); err != nil {
+		return fmt.Errorf("CMI: Error decoding %s %s: %w", what, path, err)
+	}
+	return nil
+}
+
+// decodeStrict decodes JSON into v, rejecting unknown fields.
+func decodeStrict(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+// challengePrefix is the label ACME DNS01 challenge names start with.
+const challengePrefix = "_acme-challenge."
+
+// relocationRule moves the challenge names of every domain under Suffix into
+// Zone: `_acme-challenge.<domain>` becomes `<domain>.<zone>`.
+type relocationRule struct {
+	Suffix string `json:"suffix"`
+	Zone   string `json:"zone"`
+}
+
+// validateRelocationRules normalizes the rules in place and rejects empty or
+// duplicate suffixes and empty zones.
+func validateRelocationRules(rules []relocationRule) error {
+	seen := make(map[string]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		rule.Suffix = strings.ToLower(strings.Trim(rule.Suffix, "."))
+		rule.Zone = strings.ToLower(strings.Trim(rule.Zone, "."))
+		if rule.Suffix == "" || rule.Zone == "" {
+			return fmt.Errorf("CMI: challengeRelocation rule %d needs both a suffix and a zone", i)
+		}
+		if seen[rule.Suffix] {
+			return fmt.Errorf("CMI: challengeRelocation has more than one rule for suffix %s", rule.Suffix)
+		}
+		seen[rule.Suffix] = true
+	}
+	return nil
+}
+
+// relocate returns the name the challenge record for name moves to under the
+// longest matching rule. ok is false when name is not a challenge name or no
+// rule matches.
+func relocate(rules []relocationRule, name string) (relocated string, rule relocationRule, ok bool) {
+	lower := strings.ToLower(strings.TrimSuffix(name, "."))
+	if !strings.HasPrefix(lower, challengePrefix) {
+		return "", relocationRule{}, false
+	}
+	domain := strings.TrimPrefix(lower, challengePrefix)
+
+	for _, r := range rules {
+		if domain != r.Suffix && !strings.HasSuffix(domain, "."+r.Suffix) {
+			continue
+		}
+		if !ok || len(r.Suffix) > len(rule.Suffix) {
+			rule, ok = r, true
+		}
+	}
+	if !ok {
+		return "", relocationRule{}, false
+	}
+	return domain + "." + rule.Zone, rule, true
+}
+
+// relocationZoneCache remembers relocation zones confirmed to exist as
+// authoritative zones, per Grid and view.
+type relocationZoneCache struct {
+	mu     sync.Mutex
+	exists map[string]bool
+}
+
+func (z *relocationZoneCache) known(key string) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.exists[key]
+}
+
+func (z *relocationZoneCache) add(key string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.exists == nil {
+		z.exists = make(map[string]bool)
+	}
+	z.exists[key] = true
+}
+
+// relocateChallenge applies cfg.ChallengeRelocation to name. The target zone
+// must exist as an authoritative zone in the view, so a typo in a rule fails
+// the challenge instead of creating records nobody serves.
+func (c *customDNSProviderSolver) relocateChallenge(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name string) (string, error) {
+	relocated, rule, ok := relocate(cfg.ChallengeRelocation, name)
+	if !ok {
+		return name, nil
+	}
+
+	key := gridKey(cfg) + "/" + cfg.View + "/" + rule.Zone
+	if !c.relocationZones.known(key) {
+		if err := checkZoneExists(ib, rule.Zone, cfg.View); err != nil {
+			return "", err
+		}
+		c.relocationZones.add(key)
+	}
+
+	klog.InfoS("CMI: Relocated challenge name", "name", name, "relocated", relocated, "suffix", rule.Suffix)
+	return relocated, nil
+}
+
+// checkZoneExists returns an error unless zone is an authoritative zone in view.
+func checkZoneExists(ib ibclient.IBConnector, zone, view string) error {
+	var zones []ibclient.ZoneAuth
+	params := map[string]string{
+		"fqdn": zone,
+		"view": view,
+	}
+	err := ib.GetObject(ibclient.NewZoneAuth(ibclient.ZoneAuth{}), "", ibclient.NewQueryParams(false, params), &zones)
+
+	var notFoundErr *ibclient.NotFoundError
+	if errors.As(err, &notFoundErr) || (err == nil && len(zones) == 0) {
+		return fmt.Errorf("CMI: challengeRelocation zone %s does not exist in view %s", zone, view)
+	}
+	if err != nil {
+		return fmt.Errorf("CMI: Error looking up challengeRelocation zone %s: %w", zone, err)
+	}
+	return nil
+}
+
+// relocationCNAME returns the CNAME that must exist for domain to use its
+// relocated challenge name, in zone file notation.
+func relocationCNAME(rules []relocationRule, domain string) (string, bool) {
+	name := challengePrefix + strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+	relocated, _, ok := relocate(rules, name)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s.\tCNAME\t%s.", strings.ToLower(name), relocated), true
+}
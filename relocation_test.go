@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRelocationRules are the rules used by the relocation tests.
+var testRelocationRules = []relocationRule{
+	{Suffix: "example.com", Zone: "acme.example.net"},
+	{Suffix: "internal.example.com", Zone: "acme-internal.example.net"},
+}
+
+// TestRelocate verifies challenge names are relocated under the longest
+// matching suffix
+func TestRelocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "_acme-challenge.example.com.", want: "example.com.acme.example.net", wantOK: true},
+		{name: "_acme-challenge.app.example.com", want: "app.example.com.acme.example.net", wantOK: true},
+		{name: "_ACME-CHALLENGE.App.Example.com", want: "app.example.com.acme.example.net", wantOK: true},
+		{name: "_acme-challenge.db.internal.example.com", want: "db.internal.example.com.acme-internal.example.net", wantOK: true},
+		{name: "_acme-challenge.notexample.com"},
+		{name: "_acme-challenge.example.org"},
+		{name: "app.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, ok := relocate(testRelocationRules, tt.name)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestValidateRelocationRules verifies rules are normalized and incomplete or
+// duplicate rules are rejected
+func TestValidateRelocationRules(t *testing.T) {
+	rules := []relocationRule{{Suffix: ".Example.COM.", Zone: "Acme.Example.net."}}
+	require.NoError(t, validateRelocationRules(rules))
+	assert.Equal(t, relocationRule{Suffix: "example.com", Zone: "acme.example.net"}, rules[0])
+
+	assert.Error(t, validateRelocationRules([]relocationRule{{Suffix: "example.com"}}))
+	assert.Error(t, validateRelocationRules([]relocationRule{{Zone: "acme.example.net"}}))
+	assert.Error(t, validateRelocationRules([]relocationRule{
+		{Suffix: "example.com", Zone: "a.example.net"},
+		{Suffix: "EXAMPLE.com", Zone: "b.example.net"},
+	}))
+}
+
+// TestPresentCleanUp_Relocated verifies the TXT record is managed at the
+// relocated name and the target zone is looked up once
+func TestPresentCleanUp_Relocated(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.add("zone_auth", map[string]interface{}{"fqdn": "acme.example.net", "view": "default"})
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{
+		"view":                "default",
+		"version":             "2.10",
+		"challengeRelocation": []map[string]string{{"suffix": "example.com", "zone": "acme.example.net"}},
+	}
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", extra)
+
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", map[string]string{"name": "app.example.com.acme.example.net", "text": "key-1"}), 1)
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("record:txt", nil))
+	assert.Equal(t, 1, f.count("GET zone_auth"))
+}
+
+// TestPresent_RelocationZoneMissing verifies a rule pointing at a zone that
+// does not exist fails the challenge without creating anything
+func TestPresent_RelocationZoneMissing(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.add("zone_auth", map[string]interface{}{"fqdn": "acme.example.net", "view": "internal"})
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{
+		"view":                "default",
+		"version":             "2.10",
+		"challengeRelocation": []map[string]string{{"suffix": "example.com", "zone": "acme.example.net"}},
+	}
+
+	err := solver.Present(fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", extra))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist in view default")
+	assert.Empty(t, f.find("record:txt", nil))
+}
+
+// TestRunRelocationCNAMEs verifies the CLI helper prints one CNAME per domain
+// and fails for domains without a rule
+func TestRunRelocationCNAMEs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "host: infoblox.local\nchallengeRelocation:\n  - suffix: example.com\n    zone: acme.example.net\n"
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	var out bytes.Buffer
+	require.NoError(t, runRelocationCNAMEs([]string{"-config", path, "example.com", "*.app.example.com"}, &out))
+	assert.Equal(t,
+		"_acme-challenge.example.com.\tCNAME\texample.com.acme.example.net.\n"+
+			"_acme-challenge.app.example.com.\tCNAME\tapp.example.com.acme.example.net.\n",
+		out.String())
+
+	out.Reset()
+	err := runRelocationCNAMEs([]string{"-config", path, "example.org"}, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "example.org")
+}
+
+// TestSplitSubcommand verifies the subcommand is found after leading flags
+// such as the entrypoint's -v
+func TestSplitSubcommand(t *testing.T) {
+	name, rest := splitSubcommand([]string{"-v=4", "relocation-cnames", "-config", "c.yaml", "example.com"})
+	assert.Equal(t, "relocation-cnames", name)
+	assert.Equal(t, []string{"-config", "c.yaml", "example.com"}, rest)
+
+	name, _ = splitSubcommand([]string{"-v=4", "--tls-cert-file", "/tls/tls.crt"})
+	assert.Equal(t, "/tls/tls.crt", name)
+	assert.NotContains(t, subcommands, name)
+}
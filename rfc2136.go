@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/miekg/dns"
+	"k8s.io/klog/v2"
+)
+
+// Operations on a challenge, as logged and in metrics.
+const (
+	opPresent = "present"
+	opCleanUp = "cleanup"
+)
+
+// Paths a challenge can be served by, as logged.
+const (
+	pathWAPI    = "wapi"
+	pathRFC2136 = "rfc2136"
+)
+
+// tsigFudge is the clock skew allowed on TSIG-signed updates, in seconds.
+const tsigFudge = 300
+
+// tsigAlgorithms maps the supported tsigAlgorithm values to their names.
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// rfc2136Config configures the RFC 2136 dynamic update fallback used while
+// WAPI is unreachable, e.g. when the Grid Master is down for maintenance and
+// the Grid members still accept TSIG-signed updates.
+type rfc2136Config struct {
+	// Nameservers are the members to send updates to, as host or host:port,
+	// tried in order.
+	Nameservers []string `json:"nameservers"`
+	// TSIGKeyName is the name of the TSIG key updates are signed with.
+	TSIGKeyName string `json:"tsigKeyName"`
+	// TSIGAlgorithm is hmac-sha1, hmac-sha256 or hmac-sha512 (default: hmac-sha256).
+	TSIGAlgorithm string `json:"tsigAlgorithm"`
+	// TSIGSecretSecretRef refers to the base64 TSIG secret.
+	TSIGSecretSecretRef secretKeySelector `json:"tsigSecretSecretRef"`
+}
+
+// validateRFC2136 checks the rfc2136 block, adds the default port to its
+// nameservers and canonicalizes the key name and algorithm.
+func validateRFC2136(cfg *rfc2136Config) error {
+	if cfg == nil {
+		return nil
+	}
+	if len(cfg.Nameservers) == 0 {
+		return fmt.Errorf("CMI: rfc2136.nameservers must list at least one nameserver")
+	}
+	for i, ns := range cfg.Nameservers {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			cfg.Nameservers[i] = net.JoinHostPort(ns, "53")
+		}
+	}
+	if cfg.TSIGKeyName == "" || cfg.TSIGSecretSecretRef.Name == "" || cfg.TSIGSecretSecretRef.Key == "" {
+		return fmt.Errorf("CMI: rfc2136.tsigKeyName and rfc2136.tsigSecretSecretRef are required")
+	}
+	cfg.TSIGKeyName = dns.CanonicalName(cfg.TSIGKeyName)
+
+	algorithm := strings.TrimSuffix(strings.ToLower(cfg.TSIGAlgorithm), ".")
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+	name, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("CMI: Unsupported rfc2136.tsigAlgorithm %q, must be hmac-sha1, hmac-sha256 or hmac-sha512", cfg.TSIGAlgorithm)
+	}
+	cfg.TSIGAlgorithm = name
+	return nil
+}
+
+// isConnectivityError reports whether err means WAPI could not be reached at
+// all, as opposed to WAPI answering with an error.
+func isConnectivityError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// withRFC2136Fallback returns the result of the WAPI path, err, unless WAPI
+// was unreachable and cfg has an rfc2136 block. In that case the
+// challenge is presented or cleaned up with RFC 2136 updates instead. The
+// path used is logged.
+func (c *customDNSProviderSolver) withRFC2136Fallback(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest, remove bool, err error) error {
+	op := opPresent
+	if remove {
+		op = opCleanUp
+	}
+	if err == nil {
+		klog.InfoS("CMI: Challenge served", "op", op, "path", pathWAPI, "DNS", ch.DNSName)
+		return nil
+	}
+	if !isConnectivityError(err) || cfg.RFC2136 == nil {
+		return err
+	}
+	klog.InfoS("CMI: WAPI is unreachable, falling back to RFC 2136 dynamic updates", "op", op, "error", err.Error())
+
+	if updateErr := c.rfc2136Update(cfg, ch, remove); updateErr != nil {
+		return errors.Join(err, updateErr)
+	}
+	klog.InfoS("CMI: Challenge served", "op", op, "path", pathRFC2136, "DNS", ch.DNSName)
+	return nil
+}
+
+// rfc2136Update adds or removes the challenge's TXT record with a
+// TSIG-signed dynamic update, sent to each configured nameserver in turn
+// until one accepts it. Without WAPI, CNAMEs at the challenge name cannot be
+// followed, but challengeRelocation rules are applied.
+func (c *customDNSProviderSolver) rfc2136Update(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest, remove bool) error {
+	name, zone, err := rfc2136Names(cfg, ch)
+	if err != nil {
+		return err
+	}
+	secret, err := c.getSecretRef(cfg.RFC2136.TSIGSecretSecretRef, ch.ResourceNamespace)
+	if err != nil {
+		return err
+	}
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: cfg.TTL},
+		Txt: []string{ch.Key},
+	}
+	msg := new(dns.Msg)
+	msg.SetUpdate(zone)
+	if remove {
+		msg.Remove([]dns.RR{rr})
+	} else {
+		msg.Insert([]dns.RR{rr})
+	}
+	msg.SetTsig(cfg.RFC2136.TSIGKeyName, cfg.RFC2136.TSIGAlgorithm, tsigFudge, time.Now().Unix())
+
+	client := &dns.Client{
+		Net:        "tcp",
+		Timeout:    time.Duration(cfg.HTTPRequestTimeout) * time.Second,
+		TsigSecret: map[string]string{cfg.RFC2136.TSIGKeyName: secret},
+	}
+	var errs []error
+	for _, ns := range cfg.RFC2136.Nameservers {
+		klog.InfoS("CMI: Sending RFC 2136 update", "nameserver", ns, "zone", zone, "name", name, "remove", remove)
+		resp, _, err := client.Exchange(msg, ns)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+		case resp.Rcode != dns.RcodeSuccess:
+			errs = append(errs, fmt.Errorf("%s: update refused with %s", ns, dns.RcodeToString[resp.Rcode]))
+		default:
+			return nil
+		}
+	}
+	return fmt.Errorf("CMI: RFC 2136 update of %s failed on every nameserver: %w", name, errors.Join(errs...))
+}
+
+// rfc2136Names returns the fully qualified ASCII record name and the zone
+// to update for the challenge: the relocated name and the rule's zone when a
+// challengeRelocation rule matches, and the resolved name and zone otherwise.
+func rfc2136Names(cfg *customDNSProviderConfig, ch *whapi.ChallengeRequest) (string, string, error) {
+	name, err := normalizeFQDN(ch.ResolvedFQDN)
+	if err != nil {
+		return "", "", err
+	}
+	zone, err := normalizeFQDN(ch.ResolvedZone)
+	if err != nil {
+		return "", "", err
+	}
+	if relocated, rule, ok := relocate(cfg.ChallengeRelocation, name); ok {
+		name, zone = relocated, rule.Zone
+	}
+
+	asciiName, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return "", "", err
+	}
+	asciiZone, err := idnaProfile.ToASCII(zone)
+	if err != nil {
+		return "", "", err
+	}
+	return dns.Fqdn(asciiName), dns.Fqdn(asciiZone), nil
+}
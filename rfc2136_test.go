@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const (
+	testTSIGKey    = "acme-update."
+	testTSIGSecret = "c28yWkdpcjRHUEFxSU5OaDlVNWMzQT09"
+)
+
+// fakeNameserver is a local DNS server applying TSIG-signed updates to an
+// in-memory set of TXT records.
+type fakeNameserver struct {
+	addr string
+
+	mu      sync.Mutex
+	records map[string]bool
+	zones   []string
+}
+
+func newFakeNameserver(t *testing.T) *fakeNameserver {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ns := &fakeNameserver{addr: listener.Addr().String(), records: map[string]bool{}}
+
+	server := &dns.Server{
+		Listener:   listener,
+		TsigSecret: map[string]string{testTSIGKey: testTSIGSecret},
+		Handler:    dns.HandlerFunc(ns.serveDNS),
+		// The default accept func refuses updates as not implemented
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return ns
+}
+
+func (ns *fakeNameserver) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		resp.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(resp)
+		return
+	}
+
+	ns.mu.Lock()
+	ns.zones = append(ns.zones, req.Question[0].Name)
+	for _, rr := range req.Ns {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		key := txt.Hdr.Name + " " + txt.Txt[0]
+		if txt.Hdr.Class == dns.ClassNONE {
+			delete(ns.records, key)
+		} else {
+			ns.records[key] = true
+		}
+	}
+	ns.mu.Unlock()
+
+	resp.SetTsig(testTSIGKey, dns.HmacSHA256, tsigFudge, int64(req.IsTsig().TimeSigned))
+	_ = w.WriteMsg(resp)
+}
+
+func (ns *fakeNameserver) has(name, text string) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return ns.records[name+" "+text]
+}
+
+// unreachableAddr returns an address nothing listens on.
+func unreachableAddr(t *testing.T) (string, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	return host, port
+}
+
+// rfc2136Challenge builds a ChallengeRequest for a WAPI host at host:port
+// with an rfc2136 fallback to nameservers.
+func rfc2136Challenge(t *testing.T, host, port string, nameservers []string, extra map[string]interface{}) *whapi.ChallengeRequest {
+	t.Helper()
+	cfg := map[string]interface{}{
+		"host":              host,
+		"port":              port,
+		"view":              "default",
+		"version":           "2.10",
+		"usernameSecretRef": map[string]string{"name": "infoblox-creds", "key": "username"},
+		"passwordSecretRef": map[string]string{"name": "infoblox-creds", "key": "password"},
+		"rfc2136": map[string]interface{}{
+			"nameservers":         nameservers,
+			"tsigKeyName":         "acme-update",
+			"tsigSecretSecretRef": map[string]string{"name": "tsig", "key": "secret"},
+		},
+	}
+	for k, v := range extra {
+		cfg[k] = v
+	}
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	return &whapi.ChallengeRequest{
+		DNSName:           "app.example.com",
+		ResolvedFQDN:      "_acme-challenge.app.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "key-1",
+		ResourceNamespace: "test-namespace",
+		Config:            &apiextensionsv1.JSON{Raw: raw},
+	}
+}
+
+// newRFC2136Solver returns a solver with the WAPI credentials and the TSIG
+// secret the fake nameserver knows in fake Secrets.
+func newRFC2136Solver() *customDNSProviderSolver {
+	return rfc2136Solver(testTSIGSecret)
+}
+
+// rfc2136Solver returns a solver with the WAPI credentials and tsigSecret in
+// fake Secrets.
+func rfc2136Solver(tsigSecret string) *customDNSProviderSolver {
+	creds := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "infoblox-creds", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("secret123")},
+	}
+	tsig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tsig", Namespace: "test-namespace"},
+		Data:       map[string][]byte{"secret": []byte(tsigSecret)},
+	}
+	return &customDNSProviderSolver{client: fake.NewClientset(creds, tsig)}
+}
+
+// TestValidateRFC2136 verifies the rfc2136 block's defaults and required fields
+func TestValidateRFC2136(t *testing.T) {
+	ref := map[string]string{"name": "tsig", "key": "secret"}
+	tests := []struct {
+		name     string
+		cfg      map[string]interface{}
+		wantNS   []string
+		wantAlgo string
+		wantErr  string
+	}{
+		{
+			name:     "defaults",
+			cfg:      map[string]interface{}{"nameservers": []string{"10.0.0.1", "ns2.example.com:5353", "2001:db8::1"}, "tsigKeyName": "Acme-Update", "tsigSecretSecretRef": ref},
+			wantNS:   []string{"10.0.0.1:53", "ns2.example.com:5353", "[2001:db8::1]:53"},
+			wantAlgo: dns.HmacSHA256,
+		},
+		{
+			name:     "algorithm",
+			cfg:      map[string]interface{}{"nameservers": []string{"10.0.0.1"}, "tsigKeyName": "acme", "tsigAlgorithm": "HMAC-SHA512.", "tsigSecretSecretRef": ref},
+			wantNS:   []string{"10.0.0.1:53"},
+			wantAlgo: dns.HmacSHA512,
+		},
+		{name: "no nameservers", cfg: map[string]interface{}{"tsigKeyName": "acme", "tsigSecretSecretRef": ref}, wantErr: "at least one nameserver"},
+		{name: "no key", cfg: map[string]interface{}{"nameservers": []string{"10.0.0.1"}}, wantErr: "are required"},
+		{name: "unknown algorithm", cfg: map[string]interface{}{"nameservers": []string{"10.0.0.1"}, "tsigKeyName": "acme", "tsigAlgorithm": "hmac-md5", "tsigSecretSecretRef": ref}, wantErr: "Unsupported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(map[string]interface{}{"rfc2136": tt.cfg})
+			require.NoError(t, err)
+
+			cfg, err := loadConfig(&apiextensionsv1.JSON{Raw: raw}, nil)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantNS, cfg.RFC2136.Nameservers)
+			assert.Equal(t, tt.wantAlgo, cfg.RFC2136.TSIGAlgorithm)
+			assert.Equal(t, dns.CanonicalName(tt.cfg["tsigKeyName"].(string)), cfg.RFC2136.TSIGKeyName)
+		})
+	}
+}
+
+// TestPresentCleanUp_RFC2136Fallback verifies challenges are served with
+// signed dynamic updates when WAPI is unreachable, trying nameservers in turn
+func TestPresentCleanUp_RFC2136Fallback(t *testing.T) {
+	ns := newFakeNameserver(t)
+	host, port := unreachableAddr(t)
+	deadHost, deadPort := unreachableAddr(t)
+	solver := newRFC2136Solver()
+	ch := rfc2136Challenge(t, host, port, []string{net.JoinHostPort(deadHost, deadPort), ns.addr}, nil)
+
+	require.NoError(t, solver.Present(ch))
+	assert.True(t, ns.has("_acme-challenge.app.example.com.", "key-1"))
+	assert.Equal(t, []string{"example.com."}, ns.zones)
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.False(t, ns.has("_acme-challenge.app.example.com.", "key-1"))
+}
+
+// TestPresent_RFC2136FallbackRelocated verifies challengeRelocation rules
+// are applied to fallback updates
+func TestPresent_RFC2136FallbackRelocated(t *testing.T) {
+	ns := newFakeNameserver(t)
+	host, port := unreachableAddr(t)
+	solver := newRFC2136Solver()
+	ch := rfc2136Challenge(t, host, port, []string{ns.addr}, map[string]interface{}{
+		"challengeRelocation": []map[string]string{{"suffix": "example.com", "zone": "acme.example.net"}},
+	})
+
+	require.NoError(t, solver.Present(ch))
+	assert.True(t, ns.has("app.example.com.acme.example.net.", "key-1"))
+	assert.Equal(t, []string{"acme.example.net."}, ns.zones)
+}
+
+// TestPresent_RFC2136NoFallback verifies WAPI errors other than connectivity
+// errors, and configs without an rfc2136 block, do not fall back
+func TestPresent_RFC2136NoFallback(t *testing.T) {
+	ns := newFakeNameserver(t)
+
+	f := newFakeWAPI(t)
+	host, port := f.hostPort()
+	ref := f.add("record:txt", map[string]interface{}{"name": "_acme-challenge.app.example.com", "text": "key-1", "view": "default"})
+	f.failDeletes = map[string]bool{ref: true}
+	f.noBatch = true
+	solver := newRFC2136Solver()
+	ch := rfc2136Challenge(t, host, port, []string{ns.addr}, nil)
+	require.Error(t, solver.CleanUp(ch))
+
+	host, port = unreachableAddr(t)
+	ch = rfc2136Challenge(t, host, port, []string{ns.addr}, map[string]interface{}{"rfc2136": nil})
+	require.Error(t, solver.Present(ch))
+
+	assert.Empty(t, ns.zones)
+}
+
+// TestPresent_RFC2136FallbackFails verifies the WAPI and update errors are
+// both reported when every nameserver refuses the update
+func TestPresent_RFC2136FallbackFails(t *testing.T) {
+	ns := newFakeNameserver(t)
+	host, port := unreachableAddr(t)
+	// A secret the nameserver does not know makes it refuse the update
+	solver := rfc2136Solver("d3JvbmcK")
+	ch := rfc2136Challenge(t, host, port, []string{ns.addr}, nil)
+
+	err := solver.Present(ch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.Contains(t, err.Error(), "failed on every nameserver")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// creatorDynamic marks records as created by DDNS, which makes them
+	// eligible for Grid DNS scavenging.
+	creatorDynamic = "DYNAMIC"
+	// defaultDDNSPrincipal is the ddns_principal set on dynamic records when
+	// ddnsPrincipal is not configured.
+	defaultDDNSPrincipal = eventComponent
+)
+
+// validateDynamicRecords rejects dynamicRecords combined with options it
+// cannot apply to.
+func validateDynamicRecords(cfg *customDNSProviderConfig) error {
+	if !cfg.DynamicRecords {
+		if cfg.DDNSPrincipal != "" {
+			return fmt.Errorf("CMI: ddnsPrincipal requires dynamicRecords")
+		}
+		return nil
+	}
+	if cfg.SharedRecordGroup != "" {
+		return fmt.Errorf("CMI: dynamicRecords cannot be used with sharedRecordGroup, shared records are always static")
+	}
+	if cfg.DDNSPrincipal == "" {
+		cfg.DDNSPrincipal = defaultDDNSPrincipal
+	}
+	return nil
+}
+
+// scavengingReportCache remembers zones whose scavenging settings have been
+// reported, so each zone is looked up once per process.
+type scavengingReportCache struct {
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+func (s *scavengingReportCache) known(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reported[key]
+}
+
+func (s *scavengingReportCache) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reported == nil {
+		s.reported = make(map[string]bool)
+	}
+	s.reported[key] = true
+}
+
+// reportScavenging logs whether DNS scavenging is enabled on the zone the
+// dynamic TXT record at ref was created in, exports it as a metric, and
+// emits a Warning Event when it is not, since leaked records are then never
+// reclaimed. Lookup failures are only logged: the record itself is fine.
+func (c *customDNSProviderSolver) reportScavenging(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref string) {
+	if !cfg.DynamicRecords {
+		return
+	}
+
+	record, err := readTXTRecord(ib, ref, []string{"zone"})
+	if err != nil {
+		klog.InfoS("CMI: Error reading zone of TXT record, not reporting scavenging", "ref", ref, "error", err.Error())
+		return
+	}
+	key := gridKey(cfg) + "/" + cfg.View + "/" + record.Zone
+	if record.Zone == "" || c.scavengingReports.known(key) {
+		return
+	}
+
+	enabled, err := zoneScavengingEnabled(ib, record.Zone, cfg.View)
+	if err != nil {
+		klog.InfoS("CMI: Error reading scavenging settings of zone", "zone", record.Zone, "view", cfg.View, "error", err.Error())
+		return
+	}
+	c.scavengingReports.add(key)
+	zoneScavengingInfo.WithLabelValues(gridKey(cfg), cfg.View, record.Zone).Set(boolGauge(enabled))
+
+	if enabled {
+		klog.InfoS("CMI: DNS scavenging is enabled on zone, leaked dynamic TXT records will be reclaimed", "zone", record.Zone, "view", cfg.View)
+		return
+	}
+	msg := fmt.Sprintf("DNS scavenging is not enabled on zone %s in view %s, dynamic TXT records left behind by a missed CleanUp will not be reclaimed", record.Zone, cfg.View)
+	klog.InfoS("CMI: WARNING: "+msg, "zone", record.Zone, "view", cfg.View)
+	c.events.warning(reasonScavengingDisabled, msg)
+}
+
+// zoneScavengingEnabled reads the scavenging settings of zone in view.
+func zoneScavengingEnabled(ib ibclient.IBConnector, zone, view string) (bool, error) {
+	obj := ibclient.NewZoneAuth(ibclient.ZoneAuth{})
+	obj.SetReturnFields([]string{"fqdn", "view", "scavenging_settings"})
+	var zones []ibclient.ZoneAuth
+	params := map[string]string{
+		"fqdn": zone,
+		"view": view,
+	}
+	err := ib.GetObject(obj, "", ibclient.NewQueryParams(false, params), &zones)
+
+	var notFoundErr *ibclient.NotFoundError
+	if errors.As(err, &notFoundErr) || (err == nil && len(zones) == 0) {
+		return false, fmt.Errorf("CMI: Zone %s does not exist in view %s", zone, view)
+	}
+	if err != nil {
+		return false, err
+	}
+	settings := zones[0].ScavengingSettings
+	return settings != nil && settings.EnableScavenging, nil
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// TestValidateDynamicRecords verifies the ddnsPrincipal default and the
+// options dynamicRecords cannot be combined with
+func TestValidateDynamicRecords(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           customDNSProviderConfig
+		wantPrincipal string
+		wantErr       string
+	}{
+		{name: "disabled"},
+		{name: "default principal", cfg: customDNSProviderConfig{DynamicRecords: true}, wantPrincipal: defaultDDNSPrincipal},
+		{name: "custom principal", cfg: customDNSProviderConfig{DynamicRecords: true, DDNSPrincipal: "acme@EXAMPLE.COM"}, wantPrincipal: "acme@EXAMPLE.COM"},
+		{name: "principal without dynamic records", cfg: customDNSProviderConfig{DDNSPrincipal: "acme"}, wantErr: "requires dynamicRecords"},
+		{name: "shared record group", cfg: customDNSProviderConfig{DynamicRecords: true, SharedRecordGroup: "acme"}, wantErr: "sharedRecordGroup"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDynamicRecords(&tt.cfg)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPrincipal, tt.cfg.DDNSPrincipal)
+		})
+	}
+}
+
+// TestPresent_DynamicRecords verifies records are created as DYNAMIC and the
+// zone's scavenging settings are reported once
+func TestPresent_DynamicRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch bool
+	}{
+		{name: "two-step"},
+		{name: "batched", batch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			f.onCreate = func(obj map[string]interface{}) { obj["zone"] = "example.com" }
+			f.add("zone_auth", map[string]interface{}{
+				"fqdn":                "example.com",
+				"view":                "default",
+				"scavenging_settings": map[string]interface{}{"enable_scavenging": false},
+			})
+			solver := newFakeWAPISolver()
+			recorder := record.NewFakeRecorder(10)
+			solver.events = &eventEmitter{recorder: recorder, target: &corev1.ObjectReference{Kind: "Pod", Name: "webhook", Namespace: "cert-manager"}}
+			extra := map[string]interface{}{
+				"view":           "default",
+				"version":        "2.10",
+				"dynamicRecords": true,
+				"batchRequests":  tt.batch,
+			}
+
+			require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+			require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-2", extra)))
+
+			assert.Len(t, f.find("record:txt", map[string]string{"creator": creatorDynamic, "ddns_principal": defaultDDNSPrincipal}), 2)
+			assert.Equal(t, 1, f.count("GET zone_auth"))
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, "Warning ScavengingDisabled")
+		})
+	}
+}
+
+// TestPresent_StaticRecords verifies records stay static and no zone is
+// looked up without dynamicRecords
+func TestPresent_StaticRecords(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "default", "version": "2.10"})))
+
+	records := f.find("record:txt", nil)
+	require.Len(t, records, 1)
+	assert.NotContains(t, records[0], "creator")
+	assert.Zero(t, f.count("GET zone_auth"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+)
+
+// Environment variables allowing secret references to name another namespace.
+const (
+	// SecretNamespacesEnv lists, comma-separated, the namespaces secret
+	// references may name.
+	SecretNamespacesEnv = "SECRET_NAMESPACES"
+	// ClusterResourceNamespaceEnv names cert-manager's cluster resource
+	// namespace, which ClusterIssuer challenges come from.
+	ClusterResourceNamespaceEnv = "CLUSTER_RESOURCE_NAMESPACE"
+)
+
+// secretNamespaces are the namespaces named by SECRET_NAMESPACES.
+var secretNamespaces = strings.FieldsFunc(os.Getenv(SecretNamespacesEnv), func(r rune) bool { return r == ',' || r == ' ' })
+
+// clusterResourceNamespace is the namespace named by CLUSTER_RESOURCE_NAMESPACE.
+var clusterResourceNamespace = os.Getenv(ClusterResourceNamespaceEnv)
+
+// secretKeySelector selects a key of a Secret in the challenge's namespace,
+// or, for ClusterIssuers, in another namespace on the webhook's allowlist.
+type secretKeySelector struct {
+	cmmeta.SecretKeySelector `json:",inline"`
+	Namespace                string `json:"namespace,omitempty"`
+}
+
+// secretRefNamespace returns the namespace to read sel from for a challenge
+// from challengeNamespace. Only challenges from the cluster resource namespace
+// may name another namespace, so namespaced Issuers cannot read Secrets
+// outside their own namespace.
+func secretRefNamespace(sel secretKeySelector, challengeNamespace string) (string, error) {
+	if sel.Namespace == "" || sel.Namespace == challengeNamespace {
+		return challengeNamespace, nil
+	}
+	if clusterResourceNamespace == "" || challengeNamespace != clusterResourceNamespace {
+		return "", fmt.Errorf("CMI: Secret %s/%s may only be referenced across namespaces by ClusterIssuers", sel.Namespace, sel.Name)
+	}
+	if !slices.Contains(secretNamespaces, sel.Namespace) {
+		return "", fmt.Errorf("CMI: Secret %s/%s is in a namespace not allowed by %s", sel.Namespace, sel.Name, SecretNamespacesEnv)
+	}
+	return sel.Namespace, nil
+}
+
+// getSecretRef resolves sel, reading it from the namespace secretRefNamespace
+// allows.
+func (c *customDNSProviderSolver) getSecretRef(sel secretKeySelector, challengeNamespace string) (string, error) {
+	namespace, err := secretRefNamespace(sel, challengeNamespace)
+	if err != nil {
+		return "", err
+	}
+	return c.getSecret(sel.SecretKeySelector, namespace)
+}
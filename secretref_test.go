@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// useSecretNamespaces allows ClusterIssuer challenges from clusterNamespace
+// to reference Secrets in namespaces for the duration of the test.
+func useSecretNamespaces(t *testing.T, clusterNamespace string, namespaces ...string) {
+	t.Helper()
+	previousCluster, previousNamespaces := clusterResourceNamespace, secretNamespaces
+	clusterResourceNamespace, secretNamespaces = clusterNamespace, namespaces
+	t.Cleanup(func() { clusterResourceNamespace, secretNamespaces = previousCluster, previousNamespaces })
+}
+
+// TestSecretRefNamespace verifies secret references may only name another
+// namespace from the cluster resource namespace, and only an allowed one
+func TestSecretRefNamespace(t *testing.T) {
+	useSecretNamespaces(t, "cert-manager", "dns-credentials")
+
+	tests := []struct {
+		name               string
+		namespace          string
+		challengeNamespace string
+		want               string
+		wantErr            string
+	}{
+		{name: "own namespace", challengeNamespace: "team-a", want: "team-a"},
+		{name: "same namespace named", namespace: "team-a", challengeNamespace: "team-a", want: "team-a"},
+		{name: "allowed namespace", namespace: "dns-credentials", challengeNamespace: "cert-manager", want: "dns-credentials"},
+		{name: "namespaced issuer", namespace: "dns-credentials", challengeNamespace: "team-a", wantErr: "only be referenced across namespaces by ClusterIssuers"},
+		{name: "namespace not allowed", namespace: "kube-system", challengeNamespace: "cert-manager", wantErr: "not allowed by SECRET_NAMESPACES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := secretKeySelector{Namespace: tt.namespace}
+			sel.Name, sel.Key = "infoblox-creds", "username"
+
+			got, err := secretRefNamespace(sel, tt.challengeNamespace)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	useSecretNamespaces(t, "", "dns-credentials")
+	_, err := secretRefNamespace(secretKeySelector{Namespace: "dns-credentials"}, "cert-manager")
+	require.Error(t, err)
+}
+
+// TestPresent_CrossNamespaceSecret verifies a ClusterIssuer challenge reads
+// credentials from an allowed namespace
+func TestPresent_CrossNamespaceSecret(t *testing.T) {
+	useSecretNamespaces(t, "cert-manager", "dns-credentials")
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	_, err := solver.client.CoreV1().Secrets("dns-credentials").Create(context.Background(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "platform-creds", Namespace: "dns-credentials"},
+		Data:       map[string][]byte{"username": []byte("platform"), "password": []byte("platform-pass")},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	extra := map[string]interface{}{
+		"view":              "default",
+		"usernameSecretRef": map[string]string{"name": "platform-creds", "key": "username", "namespace": "dns-credentials"},
+		"passwordSecretRef": map[string]string{"name": "platform-creds", "key": "password", "namespace": "dns-credentials"},
+	}
+
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)
+	ch.ResourceNamespace = "cert-manager"
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("record:txt", nil), 1)
+
+	ch = fakeChallenge(t, f, "_acme-challenge.example.com.", "key-2", extra)
+	err = solver.Present(ch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "by ClusterIssuers")
+	assert.Len(t, f.find("record:txt", nil), 1)
+}
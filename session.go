@@ -0,0 +1,345 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"golang.org/x/net/publicsuffix"
+	"k8s.io/klog/v2"
+)
+
+// sessionCookieName is the cookie WAPI issues after a successful login.
+const sessionCookieName = "ibapauth"
+
+// sessionJar is a cookie jar that can be emptied while requests are in
+// flight, which is needed to drop an expired WAPI session.
+type sessionJar struct {
+	mu  sync.Mutex
+	jar *cookiejar.Jar
+}
+
+func newSessionJar() (*sessionJar, error) {
+	j := &sessionJar{}
+	if err := j.reset(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *sessionJar) reset() error {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.jar = jar
+	j.mu.Unlock()
+	return nil
+}
+
+// SetCookies implements http.CookieJar.
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+}
+
+// Cookies implements http.CookieJar.
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// hasSession reports whether the jar holds a WAPI session cookie for u.
+func (j *sessionJar) hasSession(u *url.URL) bool {
+	for _, cookie := range j.Cookies(u) {
+		if cookie.Name == sessionCookieName {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionRequestor is an ibclient.HttpRequestor that authenticates once with
+// basic auth and then reuses the ibapauth session cookie. The request builder
+// always adds basic auth, so the requestor strips it while a session cookie
+// is held and only falls back to it when the session is rejected.
+type sessionRequestor struct {
+	client http.Client
+	jar    *sessionJar
+	// tlsConfig, when set, replaces the TLS config derived from sslVerify,
+	// e.g. to verify the Grid against a caBundle.
+	tlsConfig *tls.Config
+}
+
+// wapiTLSConfig returns the TLS config for requests to the Grid. As with the
+// ibclient transport, certificates are only verified when sslVerify is set,
+// unless a caBundle is given to verify them against.
+func wapiTLSConfig(cfg *customDNSProviderConfig) (*tls.Config, error) {
+	if cfg.CABundle == "" {
+		return &tls.Config{InsecureSkipVerify: !cfg.SslVerify}, nil //nolint:gosec // G402: controlled by sslVerify
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(cfg.CABundle)) {
+		return nil, fmt.Errorf("CMI: caBundle contains no PEM certificates")
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Init implements ibclient.HttpRequestor.
+func (r *sessionRequestor) Init(_ ibclient.AuthConfig, trCfg ibclient.TransportConfig) {
+	jar, err := newSessionJar()
+	if err != nil {
+		// cookiejar.New only fails on invalid options, which are fixed here.
+		panic(fmt.Sprintf("CMI: Error creating WAPI cookie jar: %v", err))
+	}
+	r.jar = jar
+	tlsConfig := r.tlsConfig
+	if tlsConfig == nil {
+		// Mirrors the ibclient transport, which only verifies when sslVerify is set.
+		tlsConfig = &tls.Config{InsecureSkipVerify: !trCfg.SslVerify} //nolint:gosec // G402: controlled by sslVerify
+	}
+	r.client = http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: trCfg.HttpPoolConnections,
+			Proxy:               http.ProxyFromEnvironment,
+		},
+		// ibclient keeps the timeout in seconds in a time.Duration.
+		Timeout: trCfg.HttpRequestTimeout * time.Second,
+	}
+}
+
+// SendRequest implements ibclient.HttpRequestor.
+func (r *sessionRequestor) SendRequest(req *http.Request) ([]byte, error) {
+	if !r.jar.hasSession(req.URL) {
+		wapiAuthentications.WithLabelValues(req.URL.Host).Inc()
+		return r.send(req)
+	}
+
+	sessionReq, err := withoutBasicAuth(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.send(sessionReq)
+	if !isUnauthorized(err) {
+		return res, err
+	}
+
+	// The session expired or was revoked; log in again with basic auth.
+	klog.InfoS("CMI: WAPI session rejected, re-authenticating", "host", req.URL.Host)
+	if err := r.jar.reset(); err != nil {
+		return nil, err
+	}
+	retry, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	wapiAuthentications.WithLabelValues(req.URL.Host).Inc()
+	return r.send(retry)
+}
+
+// send performs the request with the same status handling as
+// ibclient.WapiHttpRequestor.
+func (r *sessionRequestor) send(req *http.Request) ([]byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK || (resp.StatusCode == http.StatusCreated && req.Method == http.MethodPost) {
+		return body, nil
+	}
+
+	msg := fmt.Sprintf("WAPI request error: %d('%s')\nContents:\n%s\n", resp.StatusCode, resp.Status, body)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ibclient.NewNotFoundError(msg)
+	case http.StatusUnauthorized:
+		return nil, &unauthorizedError{msg: msg}
+	default:
+		return nil, fmt.Errorf("%s", msg)
+	}
+}
+
+// unauthorizedError is returned when WAPI answers 401.
+type unauthorizedError struct {
+	msg string
+}
+
+func (e *unauthorizedError) Error() string {
+	return e.msg
+}
+
+func isUnauthorized(err error) bool {
+	var unauthorized *unauthorizedError
+	return errors.As(err, &unauthorized)
+}
+
+// cloneRequest returns a copy of req with a fresh body.
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// withoutBasicAuth returns a copy of req that relies on the session cookie only.
+func withoutBasicAuth(req *http.Request) (*http.Request, error) {
+	clone, err := cloneRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	clone.Header.Del("Authorization")
+	return clone, nil
+}
+
+// wapiSession is a cached connector together with the requestor holding its
+// session cookie.
+type wapiSession struct {
+	conn      *ibclient.Connector
+	requestor *sessionRequestor
+	gridURL   *url.URL
+}
+
+// connectorCache keeps one connector, and therefore one WAPI session, per
+// Grid connection and credential. Only the newest password of each Grid
+// connection and username is kept, so a rotated credential does not leave
+// its session behind.
+type connectorCache struct {
+	mu       sync.Mutex
+	sessions map[string]*wapiSession
+	// current maps connectorSettingsKey to the key of the newest session.
+	current map[string]string
+}
+
+// connectorSettingsKey identifies a Grid connection and username by
+// everything that shapes the connector except the password. The caBundle is
+// hashed to keep the key short.
+func connectorSettingsKey(cfg *customDNSProviderConfig, username string) string {
+	caSum := sha256.Sum256([]byte(cfg.CABundle))
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%d|%d|%s",
+		cfg.Host, cfg.Port, cfg.Version, strconv.FormatBool(cfg.SslVerify), hex.EncodeToString(caSum[:]),
+		cfg.HTTPRequestTimeout, cfg.HTTPPoolConnections, username)
+}
+
+// connectorKey identifies a connector by everything that shapes it. The
+// password is hashed so it is never kept in the key in clear text.
+func connectorKey(cfg *customDNSProviderConfig, username, password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return connectorSettingsKey(cfg, username) + "|" + hex.EncodeToString(sum[:])
+}
+
+// get returns the cached connector for cfg and the given credential,
+// creating it on first use. A connector for an older password of the same
+// username is logged out and dropped.
+func (cc *connectorCache) get(cfg *customDNSProviderConfig, username, password string) (*ibclient.Connector, error) {
+	conn, replaced, err := cc.getLocked(cfg, username, password)
+	if replaced != nil {
+		// Logged out without the lock held, so other Grids are not held up.
+		klog.InfoS("CMI: Credential changed, dropping the previous WAPI connector", "host", cfg.Host, "username", username)
+		replaced.logout()
+	}
+	return conn, err
+}
+
+// getLocked is get with the cache locked. It also returns the session
+// replaced by a new password, if any.
+func (cc *connectorCache) getLocked(cfg *customDNSProviderConfig, username, password string) (*ibclient.Connector, *wapiSession, error) {
+	settingsKey := connectorSettingsKey(cfg, username)
+	key := connectorKey(cfg, username, password)
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if session, ok := cc.sessions[key]; ok {
+		return session.conn, nil, nil
+	}
+
+	hostConfig := ibclient.HostConfig{
+		Host:    cfg.Host,
+		Version: cfg.Version,
+		Port:    cfg.Port,
+	}
+	authConfig := ibclient.AuthConfig{
+		Username: username,
+		Password: password,
+	}
+	tlsConfig, err := wapiTLSConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	transportConfig := ibclient.NewTransportConfig(strconv.FormatBool(cfg.SslVerify), cfg.HTTPRequestTimeout, cfg.HTTPPoolConnections)
+	requestBuilder := &ibclient.WapiRequestBuilder{}
+	requestor := &sessionRequestor{tlsConfig: tlsConfig}
+
+	conn, err := ibclient.NewConnector(hostConfig, authConfig, transportConfig, requestBuilder, requestor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cc.sessions == nil {
+		cc.sessions = make(map[string]*wapiSession)
+		cc.current = make(map[string]string)
+	}
+	replaced := cc.sessions[cc.current[settingsKey]]
+	delete(cc.sessions, cc.current[settingsKey])
+	cc.current[settingsKey] = key
+	cc.sessions[key] = &wapiSession{
+		conn:      conn,
+		requestor: requestor,
+		gridURL:   &url.URL{Scheme: "https", Host: cfg.Host + ":" + cfg.Port, Path: "/"},
+	}
+	klog.InfoS("CMI: Created WAPI connector", "host", cfg.Host, "username", username)
+
+	return conn, replaced, nil
+}
+
+// logoutAll ends every open WAPI session and empties the cache.
+func (cc *connectorCache) logoutAll() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for key, session := range cc.sessions {
+		session.logout()
+		delete(cc.sessions, key)
+	}
+	clear(cc.current)
+}
+
+// logout ends the session's WAPI session, if one is open.
+func (s *wapiSession) logout() {
+	if !s.requestor.jar.hasSession(s.gridURL) {
+		return
+	}
+	if err := s.conn.Logout(); err != nil {
+		klog.InfoS("CMI: Error logging out of WAPI session", "host", s.gridURL.Host, "error", err.Error())
+	} else {
+		klog.InfoS("CMI: Logged out of WAPI session", "host", s.gridURL.Host)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSession_ReusesCookie verifies only the first request per credential
+// authenticates with basic auth and later ones ride the session cookie.
+func TestSession_ReusesCookie(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", key, extra)))
+		require.NoError(t, solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", key, extra)))
+	}
+
+	assert.Equal(t, 1, f.loginCount())
+	assert.Empty(t, f.find("record:txt", nil))
+}
+
+// TestSession_ReauthenticatesOnExpiry verifies a rejected session cookie
+// triggers one new login and the request still succeeds.
+func TestSession_ReauthenticatesOnExpiry(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+	f.expireSessions()
+	require.NoError(t, solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+
+	assert.Equal(t, 2, f.loginCount())
+	assert.Empty(t, f.find("record:txt", nil))
+}
+
+// TestSession_SeparateCredentials verifies sessions are kept per credential
+func TestSession_SeparateCredentials(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	host, port := f.hostPort()
+	cfg := customDNSProviderConfig{Host: host, Port: port, Version: "2.10"}
+	applyDefaults(&cfg)
+
+	connA, err := solver.connectors.get(&cfg, "alice", "pw-a")
+	require.NoError(t, err)
+	connA2, err := solver.connectors.get(&cfg, "alice", "pw-a")
+	require.NoError(t, err)
+	connB, err := solver.connectors.get(&cfg, "alice", "pw-b")
+	require.NoError(t, err)
+
+	assert.Same(t, connA, connA2)
+	assert.NotSame(t, connA, connB)
+}
+
+// TestSession_RotatedPassword verifies a new password for the same Grid and
+// username logs out of and drops the connector for the old one
+func TestSession_RotatedPassword(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	host, port := f.hostPort()
+	cfg := customDNSProviderConfig{Host: host, Port: port, Version: "2.10", View: "default"}
+	applyDefaults(&cfg)
+
+	oldConn, err := solver.connectors.get(&cfg, "alice", "pw-old")
+	require.NoError(t, err)
+	_, err = solver.GetTXTRecords(oldConn, &cfg, "_acme-challenge.example.com", "key-1")
+	require.NoError(t, err)
+	require.Equal(t, 1, f.activeSessions())
+
+	newConn, err := solver.connectors.get(&cfg, "alice", "pw-new")
+	require.NoError(t, err)
+
+	assert.NotSame(t, oldConn, newConn)
+	assert.Equal(t, 0, f.activeSessions())
+	assert.Len(t, solver.connectors.sessions, 1)
+	_, err = solver.connectors.get(&cfg, "bob", "pw-old")
+	require.NoError(t, err)
+	assert.Len(t, solver.connectors.sessions, 2)
+}
+
+// TestSession_LogoutAll verifies open sessions are logged out on shutdown
+func TestSession_LogoutAll(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	extra := map[string]interface{}{"view": "default", "version": "2.10"}
+
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+	require.Equal(t, 1, f.activeSessions())
+
+	solver.connectors.logoutAll()
+
+	assert.Equal(t, 0, f.activeSessions())
+	assert.Empty(t, solver.connectors.sessions)
+}
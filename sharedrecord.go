@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// sharedRecordTXT is the WAPI sharedrecord:txt object, which ibclient does
+// not model. Shared records belong to a shared record group instead of a
+// view, and their names are relative to the zones the group is linked to.
+type sharedRecordTXT struct {
+	ibclient.IBBase `json:"-"`
+
+	Ref               string  `json:"_ref,omitempty"`
+	Name              *string `json:"name,omitempty"`
+	Text              *string `json:"text,omitempty"`
+	SharedRecordGroup *string `json:"shared_record_group,omitempty"`
+	TTL               *uint32 `json:"ttl,omitempty"`
+	UseTTL            *bool   `json:"use_ttl,omitempty"`
+	Comment           *string `json:"comment,omitempty"`
+}
+
+// ObjectType implements ibclient.IBObject.
+func (sharedRecordTXT) ObjectType() string {
+	return "sharedrecord:txt"
+}
+
+// newEmptySharedRecordTXT returns a sharedrecord:txt for searches and reads.
+func newEmptySharedRecordTXT() *sharedRecordTXT {
+	obj := &sharedRecordTXT{}
+	obj.SetReturnFields([]string{"name", "text", "shared_record_group", "ttl", "use_ttl"})
+	return obj
+}
+
+// sharedRecordName returns name relative to zone, as shared records are named.
+func sharedRecordName(name, zone string) (string, error) {
+	if zone == "" {
+		return "", fmt.Errorf("CMI: No zone to make %s relative to for the shared record group", name)
+	}
+	relative, ok := strings.CutSuffix(strings.ToLower(name), "."+strings.ToLower(zone))
+	if !ok || relative == "" {
+		return "", fmt.Errorf("CMI: Record name %s is not inside zone %s, set sharedRecordZone", name, zone)
+	}
+	return relative, nil
+}
+
+// sharedSearchFields returns the fields selecting the shared records of a
+// challenge.
+func sharedSearchFields(cfg *customDNSProviderConfig, name, text string) (map[string]string, error) {
+	relative, err := sharedRecordName(name, cfg.SharedRecordZone)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"name":                relative,
+		"text":                text,
+		"shared_record_group": cfg.SharedRecordGroup,
+	}, nil
+}
+
+// getSharedTXTRecords returns the refs of every sharedrecord:txt in the
+// configured group matching name and text.
+func (c *customDNSProviderSolver) getSharedTXTRecords(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string) ([]string, error) {
+	params, err := sharedSearchFields(cfg, name, text)
+	if err != nil {
+		return nil, err
+	}
+	klog.InfoS("CMI: Getting shared TXT records", "name", params["name"], "group", cfg.SharedRecordGroup)
+
+	var records []sharedRecordTXT
+	err = ib.GetObject(newEmptySharedRecordTXT(), "", ibclient.NewQueryParams(false, params), &records)
+	var notFoundErr *ibclient.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(records))
+	for _, record := range records {
+		refs = append(refs, record.Ref)
+	}
+	return refs, nil
+}
+
+// createSharedTXTRecord creates a sharedrecord:txt in the configured group.
+func (c *customDNSProviderSolver) createSharedTXTRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, name, text string) (string, error) {
+	relative, err := sharedRecordName(name, cfg.SharedRecordZone)
+	if err != nil {
+		return "", err
+	}
+	klog.InfoS("CMI: Creating shared TXT record", "name", relative, "group", cfg.SharedRecordGroup)
+
+	record := &sharedRecordTXT{
+		Name:              &relative,
+		Text:              &text,
+		SharedRecordGroup: &cfg.SharedRecordGroup,
+		TTL:               &cfg.TTL,
+		UseTTL:            &cfg.UseTTL,
+	}
+	if cfg.comment != "" {
+		record.Comment = &cfg.comment
+	}
+	return ib.CreateObject(record)
+}
+
+// sharedRecordMismatches describes every field of the sharedrecord:txt at
+// ref that differs from the requested record, comparing the TTL when
+// compareTTL is set.
+func sharedRecordMismatches(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string, compareTTL bool) ([]string, error) {
+	want, err := sharedSearchFields(cfg, name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var got sharedRecordTXT
+	if err := ib.GetObject(newEmptySharedRecordTXT(), ref, nil, &got); err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	if gotName := ptr.Deref(got.Name, ""); !strings.EqualFold(gotName, want["name"]) {
+		mismatches = append(mismatches, fieldMismatch("name", want["name"], gotName))
+	}
+	if gotText := ptr.Deref(got.Text, ""); gotText != text {
+		mismatches = append(mismatches, fieldMismatch("text", text, gotText))
+	}
+	if gotGroup := ptr.Deref(got.SharedRecordGroup, ""); gotGroup != cfg.SharedRecordGroup {
+		mismatches = append(mismatches, fieldMismatch("shared_record_group", cfg.SharedRecordGroup, gotGroup))
+	}
+	if !compareTTL {
+		return mismatches, nil
+	}
+	if gotUseTTL := ptr.Deref(got.UseTTL, false); gotUseTTL != cfg.UseTTL {
+		mismatches = append(mismatches, fieldMismatch("use_ttl", cfg.UseTTL, gotUseTTL))
+	}
+	if gotTTL := ptr.Deref(got.TTL, 0); cfg.UseTTL && gotTTL != cfg.TTL {
+		mismatches = append(mismatches, fieldMismatch("ttl", cfg.TTL, gotTTL))
+	}
+	return mismatches, nil
+}
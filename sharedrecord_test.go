@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSharedRecordName verifies names are made relative to the zone and names
+// outside it are rejected
+func TestSharedRecordName(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		zone    string
+		want    string
+		wantErr string
+	}{
+		{name: "inside zone", record: "_acme-challenge.app.example.com", zone: "example.com", want: "_acme-challenge.app"},
+		{name: "case insensitive", record: "_acme-challenge.App.Example.com", zone: "example.COM", want: "_acme-challenge.app"},
+		{name: "outside zone", record: "_acme-challenge.app.example.org", zone: "example.com", wantErr: "not inside zone"},
+		{name: "suffix is not a label", record: "_acme-challenge.notexample.com", zone: "example.com", wantErr: "not inside zone"},
+		{name: "zone apex", record: "example.com", zone: "example.com", wantErr: "not inside zone"},
+		{name: "no zone", record: "_acme-challenge.app.example.com", wantErr: "No zone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sharedRecordName(tt.record, tt.zone)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestPresentCleanUp_SharedRecordGroup verifies challenges are published as
+// shared records in the group, named relative to the challenge's zone
+func TestPresentCleanUp_SharedRecordGroup(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{
+		"view":              "default",
+		"version":           "2.10",
+		"sharedRecordGroup": "acme",
+		"verifyRecords":     verifyReport,
+	})
+	ch.ResolvedZone = "example.com."
+
+	require.NoError(t, solver.Present(ch))
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("sharedrecord:txt", map[string]string{"name": "_acme-challenge.app", "text": "key-1", "shared_record_group": "acme"}), 1)
+	assert.Empty(t, f.find("record:txt", nil))
+
+	// A record with the same name in another group is left alone
+	f.add("sharedrecord:txt", map[string]interface{}{"name": "_acme-challenge.app", "text": "key-1", "shared_record_group": "other"})
+
+	require.NoError(t, solver.CleanUp(ch))
+	assert.Empty(t, f.find("sharedrecord:txt", map[string]string{"shared_record_group": "acme"}))
+	assert.Len(t, f.find("sharedrecord:txt", map[string]string{"shared_record_group": "other"}), 1)
+}
+
+// TestPresent_SharedRecordZone verifies sharedRecordZone overrides the
+// challenge's zone and names outside it fail
+func TestPresent_SharedRecordZone(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+	ch := fakeChallenge(t, f, "_acme-challenge.app.example.com.", "key-1", map[string]interface{}{
+		"view":              "default",
+		"version":           "2.10",
+		"sharedRecordGroup": "acme",
+		"sharedRecordZone":  "App.Example.com.",
+	})
+	ch.ResolvedZone = "example.com."
+
+	require.NoError(t, solver.Present(ch))
+	assert.Len(t, f.find("sharedrecord:txt", map[string]string{"name": "_acme-challenge", "text": "key-1"}), 1)
+
+	other := fakeChallenge(t, f, "_acme-challenge.example.org.", "key-2", map[string]interface{}{
+		"view":              "default",
+		"version":           "2.10",
+		"sharedRecordGroup": "acme",
+		"sharedRecordZone":  "example.com",
+	})
+	err := solver.Present(other)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not inside zone")
+}
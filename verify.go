@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// Values of the verifyRecords option, which controls reading a created TXT
+// record back to check it matches what was requested.
+const (
+	// verifyNone trusts the ref returned by the create. This is the default.
+	verifyNone = "none"
+	// verifyReport fails Present on a mismatch and leaves the record in place.
+	verifyReport = "report"
+	// verifyRollback fails Present on a mismatch and deletes the record.
+	verifyRollback = "rollback"
+)
+
+// verifyReturnFields are the fields compared after a create.
+var verifyReturnFields = []string{"name", "text", "view", "ttl", "use_ttl"}
+
+// validateVerifyMode rejects unknown verifyRecords values.
+func validateVerifyMode(mode string) error {
+	switch mode {
+	case "", verifyNone, verifyReport, verifyRollback:
+		return nil
+	default:
+		return fmt.Errorf("CMI: Invalid verifyRecords %q, must be one of %q, %q or %q", mode, verifyNone, verifyReport, verifyRollback)
+	}
+}
+
+// checkCreatedRecord runs the checks configured for a newly created TXT
+// record: verifyRecords and the scavenging report for dynamic records.
+func (c *customDNSProviderSolver) checkCreatedRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) error {
+	if err := c.verifyCreatedRecord(ib, cfg, ref, name, text); err != nil {
+		return err
+	}
+	c.reportScavenging(ib, cfg, ref)
+	return nil
+}
+
+// verifyCreatedRecord reads the TXT record at ref back and compares it with
+// what was requested. Depending on cfg.VerifyRecords a mismatch is returned
+// as an error, optionally after deleting the record again.
+func (c *customDNSProviderSolver) verifyCreatedRecord(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) error {
+	if cfg.VerifyRecords == "" || cfg.VerifyRecords == verifyNone {
+		return nil
+	}
+
+	klog.InfoS("CMI: Verifying created TXT record", "ref", ref)
+	mismatches, err := createdRecordMismatches(ib, cfg, ref, name, text)
+	if err != nil {
+		return fmt.Errorf("CMI: Error reading back TXT record %s: %w", ref, err)
+	}
+	if len(mismatches) == 0 {
+		klog.InfoS("CMI: Created TXT record verified", "ref", ref)
+		return nil
+	}
+
+	err = fmt.Errorf("CMI: TXT record %s does not match what was requested: %s", ref, strings.Join(mismatches, ", "))
+	klog.InfoS("CMI: Created TXT record does not match", "ref", ref, "mismatches", mismatches)
+	if cfg.VerifyRecords != verifyRollback {
+		return err
+	}
+
+	klog.InfoS("CMI: Rolling back mismatched TXT record", "ref", ref)
+	if _, delErr := ib.DeleteObject(ref); delErr != nil {
+		return errors.Join(err, fmt.Errorf("CMI: Error rolling back TXT record %s: %w", ref, delErr))
+	}
+	return err
+}
+
+// createdRecordMismatches reads the record at ref, a record:txt or a
+// sharedrecord:txt depending on cfg, and compares it with what was requested.
+func createdRecordMismatches(ib ibclient.IBConnector, cfg *customDNSProviderConfig, ref, name, text string) ([]string, error) {
+	if cfg.SharedRecordGroup != "" {
+		return sharedRecordMismatches(ib, cfg, ref, name, text, true)
+	}
+	got, err := readTXTRecord(ib, ref, verifyReturnFields)
+	if err != nil {
+		return nil, err
+	}
+	return txtRecordMismatches(got, cfg, name, text), nil
+}
+
+// txtRecordMismatches describes every field of got that differs from the
+// requested record. The TTL is only compared when the record was asked to use
+// its own TTL, since WAPI reports the inherited one otherwise.
+func txtRecordMismatches(got *ibclient.RecordTXT, cfg *customDNSProviderConfig, name, text string) []string {
+	mismatches := txtIdentityMismatches(got, name, text, cfg.View)
+
+	if gotUseTTL := ptr.Deref(got.UseTtl, false); gotUseTTL != cfg.UseTTL {
+		mismatches = append(mismatches, fieldMismatch("use_ttl", cfg.UseTTL, gotUseTTL))
+	}
+	if cfg.UseTTL {
+		if gotTTL := ptr.Deref(got.Ttl, 0); gotTTL != cfg.TTL {
+			mismatches = append(mismatches, fieldMismatch("ttl", cfg.TTL, gotTTL))
+		}
+	}
+
+	return mismatches
+}
+
+// txtIdentityMismatches describes how got differs from the name, text and
+// view identifying a challenge record. DNS names compare case insensitively.
+func txtIdentityMismatches(got *ibclient.RecordTXT, name, text, view string) []string {
+	var mismatches []string
+	if gotName := ptr.Deref(got.Name, ""); !strings.EqualFold(gotName, name) {
+		mismatches = append(mismatches, fieldMismatch("name", name, gotName))
+	}
+	if gotText := ptr.Deref(got.Text, ""); gotText != text {
+		mismatches = append(mismatches, fieldMismatch("text", text, gotText))
+	}
+	if gotView := ptr.Deref(got.View, ""); gotView != view {
+		mismatches = append(mismatches, fieldMismatch("view", view, gotView))
+	}
+	return mismatches
+}
+
+// readTXTRecord fetches the TXT record at ref with the given return fields.
+func readTXTRecord(ib ibclient.IBConnector, ref string, fields []string) (*ibclient.RecordTXT, error) {
+	obj := ibclient.NewEmptyRecordTXT()
+	obj.SetReturnFields(fields)
+	var got ibclient.RecordTXT
+	if err := ib.GetObject(obj, ref, nil, &got); err != nil {
+		return nil, err
+	}
+	return &got, nil
+}
+
+func fieldMismatch(field string, want, have interface{}) string {
+	return fmt.Sprintf("%s is %v, want %v", field, have, want)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// overrideTTL makes the fake WAPI replace the TTL of created records, as an
+// overriding zone setting would.
+func overrideTTL(obj map[string]interface{}) {
+	obj["ttl"] = 3600
+}
+
+// TestVerifyRecords_Match verifies a record matching the request passes in
+// every mode
+func TestVerifyRecords_Match(t *testing.T) {
+	for _, mode := range []string{verifyNone, verifyReport, verifyRollback} {
+		t.Run(mode, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			solver := newFakeWAPISolver()
+			extra := map[string]interface{}{"view": "default", "version": "2.10", "useTtl": true, "verifyRecords": mode}
+
+			require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+
+			assert.Len(t, f.find("record:txt", nil), 1)
+		})
+	}
+}
+
+// TestVerifyRecords_Mismatch verifies how each mode handles a record that does
+// not match what was requested
+func TestVerifyRecords_Mismatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		batch     bool
+		wantErr   bool
+		remaining int
+	}{
+		{name: "none trusts the create", mode: verifyNone, remaining: 1},
+		{name: "report keeps the record", mode: verifyReport, wantErr: true, remaining: 1},
+		{name: "rollback deletes the record", mode: verifyRollback, wantErr: true, remaining: 0},
+		{name: "rollback after a batched create", mode: verifyRollback, batch: true, wantErr: true, remaining: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWAPI(t)
+			f.onCreate = overrideTTL
+			solver := newFakeWAPISolver()
+			extra := map[string]interface{}{"view": "default", "version": "2.10", "useTtl": true, "verifyRecords": tt.mode, "batchRequests": tt.batch}
+
+			err := solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra))
+
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "ttl is 3600, want 300")
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Len(t, f.find("record:txt", nil), tt.remaining)
+		})
+	}
+}
+
+// TestTxtRecordMismatches verifies which fields are compared
+func TestTxtRecordMismatches(t *testing.T) {
+	name, text, view := "_acme-challenge.example.com", "key-1", "default"
+	ttl, otherTTL := uint32(300), uint32(3600)
+	useTTL, noTTL := true, false
+	otherView := "internal"
+	upperName := "_ACME-CHALLENGE.example.com"
+
+	tests := []struct {
+		name string
+		got  ibclient.RecordTXT
+		cfg  customDNSProviderConfig
+		want []string
+	}{
+		{
+			name: "identical",
+			got:  ibclient.RecordTXT{Name: &name, Text: &text, View: &view, Ttl: &ttl, UseTtl: &useTTL},
+			cfg:  customDNSProviderConfig{View: view, TTL: ttl, UseTTL: true},
+		},
+		{
+			name: "name differs only in case",
+			got:  ibclient.RecordTXT{Name: &upperName, Text: &text, View: &view, Ttl: &ttl, UseTtl: &useTTL},
+			cfg:  customDNSProviderConfig{View: view, TTL: ttl, UseTTL: true},
+		},
+		{
+			name: "wrong view",
+			got:  ibclient.RecordTXT{Name: &name, Text: &text, View: &otherView, Ttl: &ttl, UseTtl: &useTTL},
+			cfg:  customDNSProviderConfig{View: view, TTL: ttl, UseTTL: true},
+			want: []string{"view is internal, want default"},
+		},
+		{
+			name: "inherited ttl is ignored",
+			got:  ibclient.RecordTXT{Name: &name, Text: &text, View: &view, Ttl: &otherTTL, UseTtl: &noTTL},
+			cfg:  customDNSProviderConfig{View: view, TTL: ttl, UseTTL: false},
+		},
+		{
+			name: "use_ttl dropped",
+			got:  ibclient.RecordTXT{Name: &name, Text: &text, View: &view, Ttl: &otherTTL, UseTtl: &noTTL},
+			cfg:  customDNSProviderConfig{View: view, TTL: ttl, UseTTL: true},
+			want: []string{"use_ttl is false, want true", "ttl is 3600, want 300"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, txtRecordMismatches(&tt.got, &tt.cfg, name, text))
+		})
+	}
+}
+
+// TestLoadConfig_VerifyRecords verifies unknown verifyRecords values are rejected
+func TestLoadConfig_VerifyRecords(t *testing.T) {
+	_, err := loadConfig(&apiextensionsv1.JSON{Raw: []byte(`{"verifyRecords": "rollback"}`)}, nil)
+	require.NoError(t, err)
+
+	_, err = loadConfig(&apiextensionsv1.JSON{Raw: []byte(`{"verifyRecords": "sometimes"}`)}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid verifyRecords")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	ibclient "github.com/infobloxopen/infoblox-go-client/v2"
+	"k8s.io/klog/v2"
+)
+
+// defaultViewCache remembers the default DNS view of each Grid so the
+// `view?is_default=true` lookup is only made once per Grid for the lifetime
+// of the webhook process. Lookups are serialized per Grid by fetching, so mu
+// is never held while a Grid is being asked.
+type defaultViewCache struct {
+	fetching keyedMutex
+	mu       sync.Mutex
+	views    map[string]string
+}
+
+// get returns the cached default view for key.
+func (d *defaultViewCache) get(key string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	view, ok := d.views[key]
+	return view, ok
+}
+
+// set caches the default view for key.
+func (d *defaultViewCache) set(key, view string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.views == nil {
+		d.views = make(map[string]string)
+	}
+	d.views[key] = view
+}
+
+// gridKey identifies a Grid by the host and port used to reach its WAPI.
+func gridKey(cfg *customDNSProviderConfig) string {
+	return cfg.Host + ":" + cfg.Port
+}
+
+// resolveView returns the DNS view to use for searches and creates. An
+// explicitly configured view always wins. When no view is configured the
+// Grid's default view is looked up once and cached, so behaviour does not
+// depend on how a particular NIOS version treats an empty `view` parameter.
+func (c *customDNSProviderSolver) resolveView(ib ibclient.IBConnector, cfg *customDNSProviderConfig) (string, error) {
+	if cfg.View != "" {
+		return cfg.View, nil
+	}
+
+	key := gridKey(cfg)
+	unlock := c.defaultViews.fetching.lock(key)
+	defer unlock()
+
+	if view, ok := c.defaultViews.get(key); ok {
+		klog.InfoS("CMI: Using cached default DNS view", "grid", key, "view", view)
+		return view, nil
+	}
+
+	view, err := getDefaultView(ib)
+	if err != nil {
+		return "", err
+	}
+
+	c.defaultViews.set(key, view)
+	klog.InfoS("CMI: No view configured, using the Grid's default DNS view", "grid", key, "view", view)
+
+	return view, nil
+}
+
+// getDefaultView asks the Grid for the DNS view flagged as the default one.
+func getDefaultView(ib ibclient.IBConnector) (string, error) {
+	var views []ibclient.View
+	obj := &ibclient.View{}
+	obj.SetReturnFields([]string{"name", "is_default"})
+	params := map[string]string{
+		"is_default": "true",
+	}
+	if err := ib.GetObject(obj, "", ibclient.NewQueryParams(false, params), &views); err != nil {
+		return "", fmt.Errorf("CMI: Error looking up the default DNS view: %w", err)
+	}
+
+	for _, v := range views {
+		if v.Name != nil && *v.Name != "" {
+			return *v.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("CMI: The Grid did not report a default DNS view")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPresent_DefaultView verifies the Grid's default view is looked up once
+// and used for both searches and creates when no view is configured.
+func TestPresent_DefaultView(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.add("view", map[string]interface{}{"name": "internal", "is_default": false})
+	f.add("view", map[string]interface{}{"name": "corp-default", "is_default": true})
+	solver := newFakeWAPISolver()
+
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", nil)))
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.org.", "key-2", nil)))
+
+	records := f.find("record:txt", map[string]string{"view": "corp-default"})
+	assert.Len(t, records, 2)
+	assert.Equal(t, 1, f.count("GET view"), "default view should be looked up once per Grid")
+}
+
+// TestPresent_ConfiguredViewSkipsLookup verifies an explicit view is used as is.
+func TestPresent_ConfiguredViewSkipsLookup(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.add("view", map[string]interface{}{"name": "default", "is_default": true})
+	solver := newFakeWAPISolver()
+
+	ch := fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "external"})
+	require.NoError(t, solver.Present(ch))
+
+	assert.Len(t, f.find("record:txt", map[string]string{"view": "external"}), 1)
+	assert.Equal(t, 0, f.count("GET view"))
+}
+
+// TestResolveView_NoDefault verifies a clear error when the Grid reports no default view.
+func TestResolveView_NoDefault(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+
+	err := solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", nil))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "default DNS view")
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// fakeWAPI is a small in-memory stand-in for the Infoblox WAPI served over
+// TLS. Objects are stored as generic field maps keyed by their _ref, and GET
+// searches match every non-underscore query parameter against those fields.
+type fakeWAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	nextID  int
+	// requests counts requests by "METHOD objtype", without the WAPI version.
+	requests map[string]int
+	// versions is what the schema endpoint reports as supported.
+	versions []string
+	// usedVersions counts object requests by the WAPI version in their path.
+	usedVersions map[string]int
+	// sessions holds the valid ibapauth cookie values.
+	sessions map[string]bool
+	// logins counts requests that authenticated with basic auth.
+	logins int
+	// rejectDuplicates makes creates of an identical TXT record fail with a
+	// data conflict, as NIOS does.
+	rejectDuplicates bool
+	// noBatch makes the `request` object unknown, as on old Grids.
+	noBatch bool
+	// conflictNames holds TXT record names whose create fails with a data
+	// conflict other than a duplicate, as a missing parent zone causes.
+	conflictNames map[string]bool
+	// failDeletes holds refs whose delete fails with a server error.
+	failDeletes map[string]bool
+	// onCreate, when set, may alter each object after it is created, as zone
+	// settings can on a real Grid.
+	onCreate func(obj map[string]interface{})
+}
+
+func newFakeWAPI(t *testing.T) *fakeWAPI {
+	t.Helper()
+	f := &fakeWAPI{
+		t:            t,
+		objects:      make(map[string]map[string]interface{}),
+		requests:     make(map[string]int),
+		versions:     []string{"1.0", "2.9", "2.10", "2.11", "2.12"},
+		usedVersions: make(map[string]int),
+		sessions:     make(map[string]bool),
+	}
+	f.server = httptest.NewTLSServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// hostPort returns the host and port the fake WAPI listens on.
+func (f *fakeWAPI) hostPort() (string, string) {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(f.server.URL, "https://"))
+	require.NoError(f.t, err)
+	return host, port
+}
+
+// add stores an object of the given type and returns its ref.
+func (f *fakeWAPI) add(objType string, fields map[string]interface{}) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addLocked(objType, fields)
+}
+
+func (f *fakeWAPI) addLocked(objType string, fields map[string]interface{}) string {
+	f.nextID++
+	name, _ := fields["name"].(string)
+	ref := fmt.Sprintf("%s/ZG5zLmJpbmRfdHh0$%d:%s", objType, f.nextID, name)
+	obj := map[string]interface{}{"_ref": ref}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	f.objects[ref] = obj
+	return ref
+}
+
+// find returns every stored object of the given type matching all fields.
+func (f *fakeWAPI) find(objType string, match map[string]string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.findLocked(objType, match)
+}
+
+func (f *fakeWAPI) findLocked(objType string, match map[string]string) []map[string]interface{} {
+	var found []map[string]interface{}
+	for ref, obj := range f.objects {
+		if !strings.HasPrefix(ref, objType+"/") {
+			continue
+		}
+		ok := true
+		for k, v := range match {
+			if fmt.Sprint(obj[k]) != v {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			found = append(found, obj)
+		}
+	}
+	return found
+}
+
+// versionUsed returns how many object requests used the given WAPI version.
+func (f *fakeWAPI) versionUsed(version string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.usedVersions[version]
+}
+
+// count returns how many requests were made for "METHOD objtype".
+func (f *fakeWAPI) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[key]
+}
+
+func (f *fakeWAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /wapi/v2.10/record:txt or /wapi/v2.10/record:txt/<id>:<name>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) < 3 || parts[0] != "wapi" {
+		http.NotFound(w, r)
+		return
+	}
+	target := parts[2]
+	objType, _, isRef := strings.Cut(target, "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.authenticateLocked(w, r) {
+		http.Error(w, "Authorization Required", http.StatusUnauthorized)
+		return
+	}
+
+	if target == "" && r.URL.Query().Has("_schema") {
+		f.requests["GET _schema"]++
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"requested_version":  strings.TrimPrefix(parts[1], "v"),
+			"supported_versions": f.versions,
+		})
+		return
+	}
+
+	f.requests[r.Method+" "+objType]++
+	f.usedVersions[strings.TrimPrefix(parts[1], "v")]++
+
+	switch {
+	case r.Method == http.MethodPost && objType == "logout":
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			delete(f.sessions, cookie.Value)
+		}
+		writeJSON(w, http.StatusOK, "")
+	case r.Method == http.MethodPost && objType == "request":
+		f.serveMultiRequestLocked(w, r)
+	case r.Method == http.MethodGet && isRef:
+		obj, ok := f.objects[target]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, obj)
+	case r.Method == http.MethodGet:
+		match := make(map[string]string)
+		for k, v := range r.URL.Query() {
+			if !strings.HasPrefix(k, "_") {
+				match[k] = v[0]
+			}
+		}
+		found := f.findLocked(objType, match)
+		if found == nil {
+			found = []map[string]interface{}{}
+		}
+		writeJSON(w, http.StatusOK, found)
+	case r.Method == http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields := make(map[string]interface{})
+		if err := json.Unmarshal(body, &fields); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ref, err := f.createLocked(objType, fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, ref)
+	case r.Method == http.MethodDelete && isRef:
+		if _, ok := f.objects[target]; !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if f.failDeletes[target] {
+			http.Error(w, "AdmConDataError: delete failed", http.StatusInternalServerError)
+			return
+		}
+		delete(f.objects, target)
+		writeJSON(w, http.StatusOK, target)
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+// createLocked stores a new object, enforcing conflictNames and
+// rejectDuplicates.
+func (f *fakeWAPI) createLocked(objType string, fields map[string]interface{}) (string, error) {
+	if objType == "record:txt" && f.conflictNames[fmt.Sprint(fields["name"])] {
+		return "", fmt.Errorf("AdmConDataError: None (IBDataConflictError: IB.Data.Conflict:The action is not allowed. A parent was not found.)")
+	}
+	if f.rejectDuplicates && objType == "record:txt" {
+		match := map[string]string{"name": fmt.Sprint(fields["name"]), "text": fmt.Sprint(fields["text"]), "view": fmt.Sprint(fields["view"])}
+		if len(f.findLocked(objType, match)) > 0 {
+			return "", fmt.Errorf("AdmConDataError: None (IBDataConflictError: IB.Data.Conflict:The record '%s' already exists.)", fields["name"])
+		}
+	}
+	ref := f.addLocked(objType, fields)
+	if f.onCreate != nil {
+		f.onCreate(f.objects[ref])
+	}
+	return ref, nil
+}
+
+// fakeRequestItem is one entry of a WAPI multi-object request.
+type fakeRequestItem struct {
+	Method             string                 `json:"method"`
+	Object             string                 `json:"object"`
+	Data               map[string]interface{} `json:"data"`
+	Args               map[string]string      `json:"args"`
+	AssignState        map[string]string      `json:"assign_state"`
+	EnableSubstitution bool                   `json:"enable_substitution"`
+	Discard            bool                   `json:"discard"`
+}
+
+// serveMultiRequestLocked executes a multi-object request. Like WAPI, the
+// whole request fails if any item fails, and nothing is changed then.
+func (f *fakeWAPI) serveMultiRequestLocked(w http.ResponseWriter, r *http.Request) {
+	if f.noBatch {
+		http.Error(w, "AdmConProtoError: Unknown object type (request)", http.StatusBadRequest)
+		return
+	}
+
+	var items []fakeRequestItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshot := make(map[string]map[string]interface{}, len(f.objects))
+	for k, v := range f.objects {
+		snapshot[k] = v
+	}
+	fail := func(msg string) {
+		f.objects = snapshot
+		http.Error(w, msg, http.StatusBadRequest)
+	}
+
+	state := make(map[string]interface{})
+	results := []interface{}{}
+	for _, item := range items {
+		object := item.Object
+		if item.EnableSubstitution {
+			for k, v := range state {
+				object = strings.ReplaceAll(object, "##STATE:"+k+":##", fmt.Sprint(v))
+			}
+			if strings.Contains(object, "##STATE:") {
+				fail("AdmConProtoError: Unresolved state in " + object)
+				return
+			}
+		}
+
+		var result map[string]interface{}
+		switch item.Method {
+		case "GET":
+			match := make(map[string]string)
+			for k, v := range item.Data {
+				match[k] = fmt.Sprint(v)
+			}
+			found := f.findLocked(object, match)
+			if len(found) > 0 {
+				result = found[0]
+			}
+			results = appendUnlessDiscarded(results, item.Discard, found)
+		case "POST":
+			ref, err := f.createLocked(object, item.Data)
+			if err != nil {
+				fail(err.Error())
+				return
+			}
+			result = f.objects[ref]
+			results = appendUnlessDiscarded(results, item.Discard, result)
+		case "DELETE":
+			obj, ok := f.objects[object]
+			if !ok {
+				fail("AdmConDataNotFoundError: Reference " + object + " not found")
+				return
+			}
+			if f.failDeletes[object] {
+				fail("AdmConDataError: delete failed")
+				return
+			}
+			delete(f.objects, object)
+			result = obj
+			results = appendUnlessDiscarded(results, item.Discard, object)
+		case "STATE:DISPLAY":
+			results = append(results, state)
+			continue
+		default:
+			fail("AdmConProtoError: Unsupported method " + item.Method)
+			return
+		}
+
+		for stateKey, field := range item.AssignState {
+			if result == nil {
+				fail("AdmConProtoError: Nothing to assign to state " + stateKey)
+				return
+			}
+			state[stateKey] = result[field]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func appendUnlessDiscarded(results []interface{}, discard bool, v interface{}) []interface{} {
+	if discard {
+		return results
+	}
+	return append(results, v)
+}
+
+// authenticateLocked accepts a valid session cookie or any basic auth
+// credential, issuing a new session cookie for the latter like WAPI does.
+func (f *fakeWAPI) authenticateLocked(w http.ResponseWriter, r *http.Request) bool {
+	if _, _, ok := r.BasicAuth(); ok {
+		f.logins++
+		f.nextID++
+		token := fmt.Sprintf("session-%d", f.nextID)
+		f.sessions[token] = true
+		http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: token, Path: "/"})
+		return true
+	}
+	cookie, err := r.Cookie(sessionCookieName)
+	return err == nil && f.sessions[cookie.Value]
+}
+
+// expireSessions invalidates every issued session cookie.
+func (f *fakeWAPI) expireSessions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = make(map[string]bool)
+}
+
+// activeSessions returns how many session cookies are still valid.
+func (f *fakeWAPI) activeSessions() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sessions)
+}
+
+// loginCount returns how many requests authenticated with basic auth.
+func (f *fakeWAPI) loginCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newFakeWAPISolver returns a solver whose Kubernetes client holds the
+// credentials referenced by the challenge config built by fakeChallenge.
+func newFakeWAPISolver() *customDNSProviderSolver {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "infoblox-creds",
+			Namespace: "test-namespace",
+		},
+		Data: map[string][]byte{
+			"username": []byte("admin"),
+			"password": []byte("secret123"),
+		},
+	}
+	return &customDNSProviderSolver{client: fake.NewClientset(secret)}
+}
+
+// fakeChallenge builds a ChallengeRequest pointing at the fake WAPI. extra is
+// merged into the solver config.
+func fakeChallenge(t *testing.T, f *fakeWAPI, fqdn, key string, extra map[string]interface{}) *whapi.ChallengeRequest {
+	t.Helper()
+	host, port := f.hostPort()
+	cfg := map[string]interface{}{
+		"host":              host,
+		"port":              port,
+		"usernameSecretRef": map[string]string{"name": "infoblox-creds", "key": "username"},
+		"passwordSecretRef": map[string]string{"name": "infoblox-creds", "key": "password"},
+	}
+	for k, v := range extra {
+		cfg[k] = v
+	}
+	raw, err := json.Marshal(cfg)
+	require.NoError(t, err)
+
+	return &whapi.ChallengeRequest{
+		ResolvedFQDN:      fqdn,
+		Key:               key,
+		ResourceNamespace: "test-namespace",
+		Config:            &apiextensionsv1.JSON{Raw: raw},
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// versionAuto asks the webhook to negotiate the WAPI version with the Grid.
+const versionAuto = "auto"
+
+// schemaProbeVersion is the WAPI version used to request the schema. Every
+// Grid that supports the schema endpoint accepts it.
+const schemaProbeVersion = "1.0"
+
+// supportedWAPIVersions lists the WAPI versions this webhook works with,
+// oldest first. Negotiation picks the newest one the Grid also supports.
+var supportedWAPIVersions = []string{
+	"2.5", "2.6", "2.7", "2.8", "2.9", "2.10", "2.11", "2.12", "2.13",
+}
+
+// wapiVersionCache remembers the negotiated WAPI version of each Grid so the
+// schema is only requested once per host for the lifetime of the process.
+// Negotiation is serialized per Grid by fetching, so mu is never held while a
+// Grid is being asked and one slow Grid does not hold up the others.
+type wapiVersionCache struct {
+	fetching keyedMutex
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+// get returns the cached version for key.
+func (w *wapiVersionCache) get(key string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	version, ok := w.versions[key]
+	return version, ok
+}
+
+// set caches the version for key.
+func (w *wapiVersionCache) set(key, version string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.versions == nil {
+		w.versions = make(map[string]string)
+	}
+	w.versions[key] = version
+}
+
+// wapiSchema is the subset of the `?_schema` response the webhook needs.
+type wapiSchema struct {
+	SupportedVersions []string `json:"supported_versions"`
+}
+
+// negotiateVersion resolves cfg.Version. Explicitly configured versions are
+// used as is; "auto" is replaced by the newest version supported by both the
+// webhook and the Grid.
+func (c *customDNSProviderSolver) negotiateVersion(cfg *customDNSProviderConfig, username, password string) (string, error) {
+	key := gridKey(cfg)
+	if cfg.Version != versionAuto {
+		wapiVersionInfo.WithLabelValues(key, cfg.Version, "configured").Set(1)
+		return cfg.Version, nil
+	}
+
+	unlock := c.wapiVersions.fetching.lock(key)
+	defer unlock()
+
+	if version, ok := c.wapiVersions.get(key); ok {
+		return version, nil
+	}
+
+	gridVersions, err := fetchSupportedVersions(cfg, username, password)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := pickWAPIVersion(gridVersions)
+	if err != nil {
+		return "", fmt.Errorf("CMI: Error negotiating WAPI version with %s: %w", key, err)
+	}
+
+	c.wapiVersions.set(key, version)
+	wapiVersionInfo.WithLabelValues(key, version, "negotiated").Set(1)
+	klog.InfoS("CMI: Negotiated WAPI version", "grid", key, "version", version, "gridVersions", gridVersions)
+
+	return version, nil
+}
+
+// fetchSupportedVersions requests the WAPI schema and returns the versions the
+// Grid reports as supported.
+func fetchSupportedVersions(cfg *customDNSProviderConfig, username, password string) ([]string, error) {
+	timeout := time.Duration(cfg.HTTPRequestTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	u := url.URL{
+		Scheme:   "https",
+		Host:     cfg.Host + ":" + cfg.Port,
+		Path:     "/wapi/v" + schemaProbeVersion + "/",
+		RawQuery: "_schema",
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(username, password)
+
+	tlsConfig, err := wapiTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: timeout,
+	}
+
+	klog.InfoS("CMI: Requesting WAPI schema", "host", cfg.Host)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CMI: Error requesting WAPI schema: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("CMI: Error reading WAPI schema: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CMI: WAPI schema request failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var schema wapiSchema
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return nil, fmt.Errorf("CMI: Error decoding WAPI schema: %w", err)
+	}
+
+	return schema.SupportedVersions, nil
+}
+
+// pickWAPIVersion returns the newest entry of supportedWAPIVersions that the
+// Grid also supports.
+func pickWAPIVersion(gridVersions []string) (string, error) {
+	grid := make(map[string]bool, len(gridVersions))
+	for _, v := range gridVersions {
+		grid[v] = true
+	}
+
+	for i := len(supportedWAPIVersions) - 1; i >= 0; i-- {
+		if grid[supportedWAPIVersions[i]] {
+			return supportedWAPIVersions[i], nil
+		}
+	}
+
+	return "", fmt.Errorf("no common WAPI version, Grid supports %v, webhook supports %v", gridVersions, supportedWAPIVersions)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPickWAPIVersion verifies the newest common version is chosen
+func TestPickWAPIVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		gridVersions []string
+		expected     string
+		wantError    bool
+	}{
+		{
+			name:         "newest common version",
+			gridVersions: []string{"1.0", "2.5", "2.10", "2.11"},
+			expected:     "2.11",
+		},
+		{
+			name:         "grid newer than webhook",
+			gridVersions: []string{"2.12", "2.13", "2.99"},
+			expected:     "2.13",
+		},
+		{
+			name:         "old grid",
+			gridVersions: []string{"1.0", "1.4", "2.5"},
+			expected:     "2.5",
+		},
+		{
+			name:         "no common version",
+			gridVersions: []string{"1.0", "1.4"},
+			wantError:    true,
+		},
+		{
+			name:      "empty schema",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := pickWAPIVersion(tt.gridVersions)
+
+			if tt.wantError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "no common WAPI version")
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestPresent_NegotiatesVersion verifies "auto" requests the schema once per
+// Grid and uses the negotiated version for object requests.
+func TestPresent_NegotiatesVersion(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.versions = []string{"1.0", "2.9", "2.11"}
+	solver := newFakeWAPISolver()
+
+	extra := map[string]interface{}{"view": "default"}
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+	require.NoError(t, solver.CleanUp(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+
+	assert.Equal(t, 1, f.count("GET _schema"))
+	assert.Positive(t, f.versionUsed("2.11"))
+	assert.Zero(t, f.versionUsed("2.10"))
+}
+
+// TestPresent_ExplicitVersionSkipsNegotiation verifies a configured version takes priority
+func TestPresent_ExplicitVersionSkipsNegotiation(t *testing.T) {
+	f := newFakeWAPI(t)
+	solver := newFakeWAPISolver()
+
+	extra := map[string]interface{}{"view": "default", "version": "2.9"}
+	require.NoError(t, solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", extra)))
+
+	assert.Zero(t, f.count("GET _schema"))
+	assert.Positive(t, f.versionUsed("2.9"))
+}
+
+// TestPresent_NoCommonVersion verifies negotiation failures surface clearly
+func TestPresent_NoCommonVersion(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.versions = []string{"1.0", "1.4"}
+	solver := newFakeWAPISolver()
+
+	err := solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", map[string]interface{}{"view": "default"}))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error negotiating WAPI version")
+}
+
+// TestPresent_NegotiationPerGrid verifies a Grid that is slow to answer its
+// version or view lookup does not hold up challenges for other Grids
+func TestPresent_NegotiationPerGrid(t *testing.T) {
+	f := newFakeWAPI(t)
+	f.add("view", map[string]interface{}{"name": "default", "is_default": true})
+	solver := newFakeWAPISolver()
+	unlockVersion := solver.wapiVersions.fetching.lock("gm.slow.example.com:443")
+	defer unlockVersion()
+	unlockView := solver.defaultViews.fetching.lock("gm.slow.example.com:443")
+	defer unlockView()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- solver.Present(fakeChallenge(t, f, "_acme-challenge.example.com.", "key-1", nil))
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Present waited for another Grid's lookup")
+	}
+	assert.Equal(t, 1, f.count("GET _schema"))
+}